@@ -0,0 +1,341 @@
+package agenttest
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+type Mode int
+
+const (
+	// ModeReplay serves responses from the cassette and fails any request
+	// that was not recorded.
+	ModeReplay Mode = iota
+	// ModeRecord sends requests over the network and appends each
+	// request/response pair to the cassette.
+	ModeRecord
+)
+
+// ModeFromEnv returns ModeRecord when CASSETTE_MODE=record and ModeReplay
+// otherwise.
+func ModeFromEnv() Mode {
+	if os.Getenv("CASSETTE_MODE") == "record" {
+		return ModeRecord
+	}
+	return ModeReplay
+}
+
+const redacted = "REDACTED"
+
+// Credentials are scrubbed from these headers, query and form parameters and
+// JSON body fields, in requests and responses, before anything is written to
+// disk.
+var (
+	secretHeaders = []string{"Authorization", "X-Goog-Api-Key", "X-Subscription-Token", "X-Api-Key"}
+	secretParams  = []string{"key", "api_key", "access_token", "assertion", "client_secret", "refresh_token"}
+	secretFields  = []string{"api_key", "apiKey", "access_token", "id_token", "refresh_token", "private_key", "client_secret"}
+)
+
+type RecordedRequest struct {
+	Method string      `json:"method"`
+	URL    string      `json:"url"`
+	Header http.Header `json:"header,omitempty"`
+	Body   string      `json:"body,omitempty"`
+}
+
+type RecordedResponse struct {
+	StatusCode int         `json:"status_code"`
+	Header     http.Header `json:"header,omitempty"`
+	Body       string      `json:"body,omitempty"`
+}
+
+type Interaction struct {
+	Request  RecordedRequest  `json:"request"`
+	Response RecordedResponse `json:"response"`
+}
+
+type Cassette struct {
+	Interactions []Interaction `json:"interactions"`
+}
+
+// Recorder is an http.RoundTripper that records traffic to, or replays it
+// from, a cassette file. Requests match on method, scrubbed URL and body.
+type Recorder struct {
+	Path string
+	Mode Mode
+
+	// Transport carries real traffic in ModeRecord. It defaults to
+	// http.DefaultTransport.
+	Transport http.RoundTripper
+
+	// Normalize, when set, is applied to request bodies on both sides of a
+	// replay comparison, e.g. to blank out the current date in prompts.
+	Normalize func(body string) string
+
+	mu       sync.Mutex
+	cassette Cassette
+	used     []bool
+}
+
+// NewRecorder opens the cassette at path. In ModeReplay the file must exist.
+func NewRecorder(path string, mode Mode) (*Recorder, error) {
+	r := &Recorder{Path: path, Mode: mode}
+	if mode == ModeRecord {
+		return r, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cassette: %w", err)
+	}
+	if err := json.Unmarshal(data, &r.cassette); err != nil {
+		return nil, fmt.Errorf("failed to parse cassette %s: %w", path, err)
+	}
+	r.used = make([]bool, len(r.cassette.Interactions))
+	return r, nil
+}
+
+// Client returns an http.Client that sends all traffic through r.
+func (r *Recorder) Client() *http.Client {
+	return &http.Client{Transport: r}
+}
+
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	recorded := RecordedRequest{
+		Method: req.Method,
+		URL:    scrubURL(req.URL),
+		Header: scrubHeader(req.Header),
+		Body:   scrubBody(body, req.Header.Get("Content-Type")),
+	}
+
+	if r.Mode == ModeRecord {
+		return r.record(req, recorded)
+	}
+	return r.replay(req, recorded)
+}
+
+func (r *Recorder) record(req *http.Request, recorded RecordedRequest) (*http.Response, error) {
+	transport := r.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	respBody, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(respBody))
+
+	// Scrubbing can change the body's length.
+	header := scrubHeader(resp.Header)
+	header.Del("Content-Length")
+
+	r.mu.Lock()
+	r.cassette.Interactions = append(r.cassette.Interactions, Interaction{
+		Request: recorded,
+		Response: RecordedResponse{
+			StatusCode: resp.StatusCode,
+			Header:     header,
+			Body:       scrubBody(respBody, resp.Header.Get("Content-Type")),
+		},
+	})
+	r.mu.Unlock()
+	return resp, nil
+}
+
+func (r *Recorder) replay(req *http.Request, recorded RecordedRequest) (*http.Response, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, interaction := range r.cassette.Interactions {
+		if r.used[i] || !r.matches(interaction.Request, recorded) {
+			continue
+		}
+		r.used[i] = true
+		return &http.Response{
+			StatusCode:    interaction.Response.StatusCode,
+			Status:        fmt.Sprintf("%d %s", interaction.Response.StatusCode, http.StatusText(interaction.Response.StatusCode)),
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        interaction.Response.Header.Clone(),
+			Body:          io.NopCloser(strings.NewReader(interaction.Response.Body)),
+			ContentLength: int64(len(interaction.Response.Body)),
+			Request:       req,
+		}, nil
+	}
+	return nil, fmt.Errorf("cassette %s: no recorded interaction for %s %s", r.Path, recorded.Method, recorded.URL)
+}
+
+func (r *Recorder) matches(want, got RecordedRequest) bool {
+	if want.Method != got.Method || want.URL != got.URL {
+		return false
+	}
+	wantBody, gotBody := canonicalJSON(want.Body), canonicalJSON(got.Body)
+	if r.Normalize != nil {
+		wantBody, gotBody = r.Normalize(wantBody), r.Normalize(gotBody)
+	}
+	return wantBody == gotBody
+}
+
+// Unused returns the recorded interactions that were never replayed.
+func (r *Recorder) Unused() []Interaction {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var unused []Interaction
+	for i, interaction := range r.cassette.Interactions {
+		if !r.used[i] {
+			unused = append(unused, interaction)
+		}
+	}
+	return unused
+}
+
+// Save writes the recorded interactions to Path. It is a no-op in
+// ModeReplay.
+func (r *Recorder) Save() error {
+	if r.Mode != ModeRecord {
+		return nil
+	}
+	r.mu.Lock()
+	data, err := json.MarshalIndent(r.cassette, "", "  ")
+	r.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(r.Path), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(r.Path, data, 0o644)
+}
+
+// Close saves the cassette in ModeRecord and, in ModeReplay, reports
+// interactions that were recorded but never requested.
+func (r *Recorder) Close() error {
+	if r.Mode == ModeRecord {
+		return r.Save()
+	}
+	if unused := r.Unused(); len(unused) > 0 {
+		var errs []error
+		for _, interaction := range unused {
+			errs = append(errs, fmt.Errorf("unused interaction %s %s", interaction.Request.Method, interaction.Request.URL))
+		}
+		return fmt.Errorf("cassette %s: %w", r.Path, errors.Join(errs...))
+	}
+	return nil
+}
+
+func scrubURL(u *url.URL) string {
+	scrubbed := *u
+	query := scrubbed.Query()
+	scrubValues(query)
+	scrubbed.RawQuery = query.Encode()
+	scrubbed.User = nil
+	return scrubbed.String()
+}
+
+func scrubValues(values url.Values) {
+	for _, param := range secretParams {
+		if values.Has(param) {
+			values.Set(param, redacted)
+		}
+	}
+}
+
+func scrubHeader(header http.Header) http.Header {
+	scrubbed := header.Clone()
+	for _, name := range secretHeaders {
+		if scrubbed.Get(name) != "" {
+			scrubbed.Set(name, redacted)
+		}
+	}
+	return scrubbed
+}
+
+// scrubBody redacts secrets in JSON and form-encoded bodies. A form that
+// cannot be parsed is redacted whole; other bodies are kept as they are.
+func scrubBody(body []byte, contentType string) string {
+	if len(body) == 0 {
+		return ""
+	}
+	if mediaType, _, _ := mime.ParseMediaType(contentType); mediaType == "application/x-www-form-urlencoded" {
+		form, err := url.ParseQuery(string(body))
+		if err != nil {
+			return redacted
+		}
+		scrubValues(form)
+		return form.Encode()
+	}
+	var parsed any
+	if err := json.Unmarshal(body, &parsed); err != nil {
+		return string(body)
+	}
+	scrubJSON(parsed)
+	data, err := json.Marshal(parsed)
+	if err != nil {
+		return string(body)
+	}
+	return string(data)
+}
+
+func scrubJSON(value any) {
+	switch v := value.(type) {
+	case map[string]any:
+		for key, child := range v {
+			secret := false
+			for _, field := range secretFields {
+				if key == field {
+					secret = true
+				}
+			}
+			if secret {
+				v[key] = redacted
+			} else {
+				scrubJSON(child)
+			}
+		}
+	case []any:
+		for _, child := range v {
+			scrubJSON(child)
+		}
+	}
+}
+
+// canonicalJSON re-encodes JSON bodies so key order and whitespace do not
+// affect matching. Other bodies are returned unchanged.
+func canonicalJSON(body string) string {
+	var parsed any
+	if err := json.Unmarshal([]byte(body), &parsed); err != nil {
+		return body
+	}
+	data, err := json.Marshal(parsed)
+	if err != nil {
+		return body
+	}
+	return string(data)
+}
@@ -0,0 +1,87 @@
+package agenttest
+
+import (
+	"context"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/zaynkorai/gemini-fullstack-langgraph-quickstart/agent"
+)
+
+var promptDate = regexp.MustCompile(`(January|February|March|April|May|June|July|August|September|October|November|December) \d{1,2}, \d{4}`)
+
+// TestCassetteReplay drives a one-loop research run through GeminiClient
+// over a recorded cassette. Set CASSETTE_MODE=record and GEMINI_API_KEY to
+// record it again against the live API.
+func TestCassetteReplay(t *testing.T) {
+	rec, err := NewRecorder("testdata/cassettes/basic_research.json", ModeFromEnv())
+	if err != nil {
+		t.Fatal(err)
+	}
+	answer := runRecorded(t, rec)
+
+	want := "Paris [wikipedia.org](https://vertexaisearch.cloud.google.com/grounding-api-redirect/AbF9wXE1)"
+	if !strings.Contains(answer, want) {
+		t.Errorf("answer does not contain %q: %q", want, answer)
+	}
+	if strings.Contains(answer, "vertexaisearch.cloud.google.com/id/") {
+		t.Errorf("answer still contains short URLs: %q", answer)
+	}
+	if err := rec.Close(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestCassetteScrubsSecrets(t *testing.T) {
+	data, err := os.ReadFile("testdata/cassettes/basic_research.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range []string{`"access_token": "ya29`, "assertion=ey", "AIza"} {
+		if strings.Contains(string(data), secret) {
+			t.Errorf("cassette contains %q", secret)
+		}
+	}
+
+	body := scrubBody([]byte("grant_type=urn%3Aietf%3Aparams%3Aoauth%3Agrant-type%3Ajwt-bearer&assertion=eyJhbGciOi.e30.sig"), "application/x-www-form-urlencoded")
+	if strings.Contains(body, "eyJ") || !strings.Contains(body, "assertion="+redacted) {
+		t.Errorf("form body not scrubbed: %s", body)
+	}
+	body = scrubBody([]byte(`{"access_token": "ya29.secret", "expires_in": 3599}`), "application/json; charset=utf-8")
+	if strings.Contains(body, "ya29") || !strings.Contains(body, `"expires_in":3599`) {
+		t.Errorf("JSON body not scrubbed: %s", body)
+	}
+}
+
+func runRecorded(t *testing.T, rec *Recorder) string {
+	t.Helper()
+	rec.Normalize = func(body string) string {
+		return promptDate.ReplaceAllString(body, "DATE")
+	}
+
+	// Configurable values arrive as decoded JSON, so numbers are float64.
+	config := agent.NewConfiguration().FromRunnableConfig(&agent.RunnableConfig{Configurable: map[string]interface{}{
+		"number_of_initial_queries": 1.0,
+		"max_research_loops":        1.0,
+	}})
+	config.HTTPClient = rec.Client()
+	apiKey := os.Getenv("GEMINI_API_KEY")
+	if apiKey == "" {
+		apiKey = "replay"
+	}
+	workflow, err := agent.NewWorkflowWithClient(config, &agent.GeminiClient{APIKey: apiKey, HTTPClient: rec.Client()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	state := &agent.OverallState{
+		Messages: []agent.Message{agent.HumanMessage{Content: "What is the capital of France?"}},
+	}
+	final, err := workflow.Graph.Execute(context.Background(), state, defaultMaxIterations)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return final.Messages[len(final.Messages)-1].GetContent()
+}
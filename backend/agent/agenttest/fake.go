@@ -0,0 +1,242 @@
+// Package agenttest provides a scripted stand-in for the Gemini API so the
+// research workflow can be exercised deterministically.
+package agenttest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zaynkorai/gemini-fullstack-langgraph-quickstart/agent"
+)
+
+// Duration is a time.Duration that reads from JSON strings such as "250ms".
+type Duration time.Duration
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err != nil {
+		return err
+	}
+	parsed, err := time.ParseDuration(text)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// InjectedError describes an API failure to return instead of a response.
+// Status codes go through agent.NewAPIError, so a 429 surfaces as
+// *agent.ErrRateLimited just like a real one.
+type InjectedError struct {
+	Status      int    `json:"status,omitempty"`
+	Message     string `json:"message,omitempty"`
+	BlockReason string `json:"block_reason,omitempty"`
+}
+
+func (e *InjectedError) err() error {
+	if e.BlockReason != "" {
+		return &agent.ErrSafetyBlocked{BlockReason: e.BlockReason}
+	}
+	body, _ := json.Marshal(map[string]any{
+		"error": map[string]any{"code": e.Status, "message": e.Message},
+	})
+	return agent.NewAPIError(e.Status, nil, body)
+}
+
+// Response is one scripted reply. Node, Model and Match narrow which call it
+// answers; an entry with none of them answers the next call in order. Each
+// entry is used once unless Repeat is set.
+type Response struct {
+	Node         string                   `json:"node,omitempty"`
+	Model        string                   `json:"model,omitempty"`
+	Match        string                   `json:"match,omitempty"`
+	Repeat       bool                     `json:"repeat,omitempty"`
+	Text         string                   `json:"text,omitempty"`
+	FinishReason string                   `json:"finish_reason,omitempty"`
+	Thoughts     string                   `json:"thoughts,omitempty"`
+	ToolCalls    []agent.FunctionCall     `json:"tool_calls,omitempty"`
+	Grounding    *agent.GroundingMetadata `json:"grounding,omitempty"`
+	Usage        *agent.UsageMetadata     `json:"usage,omitempty"`
+	Error        *InjectedError           `json:"error,omitempty"`
+	Latency      Duration                 `json:"latency,omitempty"`
+
+	match *regexp.Regexp
+}
+
+// Call is a request received by FakeModel.
+type Call struct {
+	Node    string
+	Model   string
+	Prompt  string
+	Request *agent.GenerateContentRequest
+}
+
+// FakeModel is an agent.ContentGenerator that plays back scripted responses
+// and records every call it receives.
+type FakeModel struct {
+	mu     sync.Mutex
+	script []*Response
+	used   []bool
+	calls  []Call
+}
+
+func NewFakeModel(responses ...Response) (*FakeModel, error) {
+	f := &FakeModel{}
+	for i := range responses {
+		r := responses[i]
+		if r.Match != "" {
+			re, err := regexp.Compile(r.Match)
+			if err != nil {
+				return nil, fmt.Errorf("response %d: invalid match pattern: %w", i, err)
+			}
+			r.match = re
+		}
+		f.script = append(f.script, &r)
+		f.used = append(f.used, false)
+	}
+	return f, nil
+}
+
+func (f *FakeModel) GenerateContent(ctx context.Context, model string, req *agent.GenerateContentRequest) (*agent.GeminiResponse, error) {
+	call := Call{
+		Node:    agent.NodeNameFromContext(ctx),
+		Model:   model,
+		Prompt:  promptText(req),
+		Request: req,
+	}
+
+	f.mu.Lock()
+	f.calls = append(f.calls, call)
+	index := len(f.calls)
+	response := f.next(call)
+	f.mu.Unlock()
+
+	if response == nil {
+		return nil, fmt.Errorf("agenttest: no scripted response for call %d (node %q, model %q)", index, call.Node, model)
+	}
+
+	if response.Latency > 0 {
+		timer := time.NewTimer(time.Duration(response.Latency))
+		defer timer.Stop()
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+
+	if response.Error != nil {
+		return nil, response.Error.err()
+	}
+
+	// Like the API, thought summaries are only returned when requested.
+	thoughts := ""
+	if config := req.GenerationConfig; config != nil && config.ThinkingConfig != nil && config.ThinkingConfig.IncludeThoughts {
+		thoughts = response.Thoughts
+	}
+
+	var parts []agent.Part
+	if thoughts != "" {
+		parts = append(parts, agent.Part{Text: thoughts, Thought: true})
+	}
+	if response.Text != "" || len(response.ToolCalls) == 0 {
+		parts = append(parts, agent.Part{Text: response.Text})
+	}
+	for i := range response.ToolCalls {
+		parts = append(parts, agent.Part{FunctionCall: &response.ToolCalls[i]})
+	}
+	finishReason := response.FinishReason
+	if finishReason == "" {
+		finishReason = agent.FinishReasonStop
+	}
+	candidate := agent.GeminiCandidate{
+		Content:      agent.Content{Role: "model", Parts: parts},
+		FinishReason: finishReason,
+	}
+	if response.Grounding != nil {
+		candidate.GroundingMetadata = *response.Grounding
+	}
+	return &agent.GeminiResponse{
+		Candidates:    []agent.GeminiCandidate{candidate},
+		UsageMetadata: response.Usage,
+		Text:          response.Text,
+		Thoughts:      thoughts,
+	}, nil
+}
+
+// next returns the first unused response that matches call. f.mu must be held.
+func (f *FakeModel) next(call Call) *Response {
+	for i, r := range f.script {
+		if f.used[i] {
+			continue
+		}
+		if r.Node != "" && r.Node != call.Node {
+			continue
+		}
+		if r.Model != "" && r.Model != call.Model {
+			continue
+		}
+		if r.match != nil && !r.match.MatchString(call.Prompt) {
+			continue
+		}
+		if !r.Repeat {
+			f.used[i] = true
+		}
+		return r
+	}
+	return nil
+}
+
+// Calls returns the calls received so far, in order.
+func (f *FakeModel) Calls() []Call {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]Call(nil), f.calls...)
+}
+
+// Unused returns the scripted responses that were never played back.
+func (f *FakeModel) Unused() []Response {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var unused []Response
+	for i, r := range f.script {
+		if !f.used[i] && !r.Repeat {
+			unused = append(unused, *r)
+		}
+	}
+	return unused
+}
+
+func promptText(req *agent.GenerateContentRequest) string {
+	var parts []string
+	if req.SystemInstruction != nil {
+		for _, part := range req.SystemInstruction.Parts {
+			parts = append(parts, part.Text)
+		}
+	}
+	for _, content := range req.Contents {
+		for _, part := range content.Parts {
+			switch {
+			case part.FunctionCall != nil:
+				parts = append(parts, part.FunctionCall.Name)
+			case part.FunctionResponse != nil:
+				data, _ := json.Marshal(part.FunctionResponse.Response)
+				parts = append(parts, string(data))
+			default:
+				parts = append(parts, part.Text)
+			}
+		}
+	}
+	return strings.Join(parts, "\n")
+}
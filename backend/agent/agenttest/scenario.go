@@ -0,0 +1,252 @@
+package agenttest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zaynkorai/gemini-fullstack-langgraph-quickstart/agent"
+)
+
+const defaultMaxIterations = 20
+
+// Expectation lists what a scenario checks after the workflow finishes.
+// Zero-valued fields are not checked. AnswerExcludes lists text the answer
+// must not contain. Bibliography maps an export style to text the export
+// must contain, and ClaimVerdicts counts the final answer's claims by
+// verdict.
+type Expectation struct {
+	AnswerContains []string            `json:"answer_contains,omitempty"`
+	AnswerExcludes []string            `json:"answer_excludes,omitempty"`
+	ResearchLoops  int                 `json:"research_loops,omitempty"`
+	Calls          int                 `json:"calls,omitempty"`
+	CallsByNode    map[string]int      `json:"calls_by_node,omitempty"`
+	Thoughts       int                 `json:"thoughts,omitempty"`
+	SkippedQueries int                 `json:"skipped_queries,omitempty"`
+	DroppedSources int                 `json:"dropped_sources,omitempty"`
+	FailedQueries  int                 `json:"failed_queries,omitempty"`
+	Bibliography   map[string][]string `json:"bibliography,omitempty"`
+	ClaimVerdicts  map[string]int      `json:"claim_verdicts,omitempty"`
+	Error          string              `json:"error,omitempty"`
+}
+
+// Scenario is a complete workflow run: the user's question, per-run
+// configuration, the scripted model responses and the expected outcome.
+// When Search is set, web research uses those scripted results instead of
+// Gemini grounding. When Pages is set, the top results are fetched from
+// those pages, keyed by URL.
+type Scenario struct {
+	Name          string                 `json:"name"`
+	Question      string                 `json:"question"`
+	Configurable  map[string]interface{} `json:"configurable,omitempty"`
+	MaxIterations int                    `json:"max_iterations,omitempty"`
+	Responses     []Response             `json:"responses"`
+	Search        []SearchScript         `json:"search,omitempty"`
+	Pages         map[string]string      `json:"pages,omitempty"`
+	Expect        Expectation            `json:"expect"`
+}
+
+func LoadScenario(path string) (*Scenario, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var scenario Scenario
+	if err := json.Unmarshal(data, &scenario); err != nil {
+		return nil, fmt.Errorf("failed to parse scenario %s: %w", path, err)
+	}
+	if scenario.Name == "" {
+		scenario.Name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+	return &scenario, nil
+}
+
+// LoadScenarios loads every scenario file matching pattern, e.g.
+// "testdata/*.json".
+func LoadScenarios(pattern string) ([]*Scenario, error) {
+	paths, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, err
+	}
+	var scenarios []*Scenario
+	for _, path := range paths {
+		scenario, err := LoadScenario(path)
+		if err != nil {
+			return nil, err
+		}
+		scenarios = append(scenarios, scenario)
+	}
+	return scenarios, nil
+}
+
+type Result struct {
+	State  *agent.OverallState
+	Model  *FakeModel
+	Events []agent.Event
+	Err    error
+}
+
+// Run executes the research workflow against a FakeModel loaded with the
+// scenario's responses. Errors from the workflow itself are returned in
+// Result.Err so they can be checked against the expectation.
+func (s *Scenario) Run(ctx context.Context) (*Result, error) {
+	model, err := NewFakeModel(s.Responses...)
+	if err != nil {
+		return nil, err
+	}
+
+	config := agent.NewConfiguration().FromRunnableConfig(&agent.RunnableConfig{Configurable: s.Configurable})
+	workflow, err := agent.NewWorkflowWithClient(config, model)
+	if err != nil {
+		return nil, err
+	}
+	if len(s.Search) > 0 {
+		search, err := NewFakeSearch(s.Search...)
+		if err != nil {
+			return nil, err
+		}
+		workflow.Nodes.SetSearchProvider(search)
+	}
+	if len(s.Pages) > 0 {
+		workflow.Nodes.SetPageFetcher(&agent.PageFetcher{
+			HTTPClient: &http.Client{Transport: &FakeWeb{Pages: s.Pages}},
+			Delay:      time.Millisecond,
+		})
+	}
+
+	maxIterations := s.MaxIterations
+	if maxIterations == 0 {
+		maxIterations = defaultMaxIterations
+	}
+	state := &agent.OverallState{
+		Messages: []agent.Message{agent.HumanMessage{Content: s.Question}},
+	}
+	var mu sync.Mutex
+	var events []agent.Event
+	final, runErr := workflow.Graph.Stream(ctx, state, maxIterations, func(event agent.Event) {
+		mu.Lock()
+		defer mu.Unlock()
+		events = append(events, event)
+	})
+	return &Result{State: final, Model: model, Events: events, Err: runErr}, nil
+}
+
+// Check compares result against the scenario's expectation and returns every
+// mismatch joined into one error.
+func (s *Scenario) Check(result *Result) error {
+	var errs []error
+	expect := s.Expect
+
+	if expect.Error != "" {
+		if result.Err == nil || !strings.Contains(result.Err.Error(), expect.Error) {
+			errs = append(errs, fmt.Errorf("expected error containing %q, got %v", expect.Error, result.Err))
+		}
+	} else if result.Err != nil {
+		errs = append(errs, fmt.Errorf("unexpected error: %w", result.Err))
+	}
+
+	answer := ""
+	if n := len(result.State.Messages); n > 0 {
+		answer = result.State.Messages[n-1].GetContent()
+	}
+	for _, want := range expect.AnswerContains {
+		if !strings.Contains(answer, want) {
+			errs = append(errs, fmt.Errorf("answer does not contain %q: %q", want, answer))
+		}
+	}
+	for _, unwanted := range expect.AnswerExcludes {
+		if strings.Contains(answer, unwanted) {
+			errs = append(errs, fmt.Errorf("answer contains %q: %q", unwanted, answer))
+		}
+	}
+
+	if expect.ResearchLoops != 0 && result.State.ResearchLoopCount != expect.ResearchLoops {
+		errs = append(errs, fmt.Errorf("expected %d research loops, got %d", expect.ResearchLoops, result.State.ResearchLoopCount))
+	}
+
+	calls := result.Model.Calls()
+	if expect.Calls != 0 && len(calls) != expect.Calls {
+		errs = append(errs, fmt.Errorf("expected %d model calls, got %d", expect.Calls, len(calls)))
+	}
+	if len(expect.CallsByNode) > 0 {
+		byNode := make(map[string]int)
+		for _, call := range calls {
+			byNode[call.Node]++
+		}
+		for node, want := range expect.CallsByNode {
+			if byNode[node] != want {
+				errs = append(errs, fmt.Errorf("expected %d calls from %s, got %d", want, node, byNode[node]))
+			}
+		}
+	}
+
+	if expect.Thoughts != 0 {
+		thoughts := 0
+		for _, event := range result.Events {
+			if event.Type == agent.EventThought {
+				thoughts++
+			}
+		}
+		if thoughts != expect.Thoughts {
+			errs = append(errs, fmt.Errorf("expected %d thought events, got %d", expect.Thoughts, thoughts))
+		}
+	}
+
+	if expect.SkippedQueries != 0 && len(result.State.SkippedQueries) != expect.SkippedQueries {
+		errs = append(errs, fmt.Errorf("expected %d skipped queries, got %d: %+v", expect.SkippedQueries, len(result.State.SkippedQueries), result.State.SkippedQueries))
+	}
+
+	if expect.FailedQueries != 0 && len(result.State.FailedQueries) != expect.FailedQueries {
+		errs = append(errs, fmt.Errorf("expected %d failed queries, got %d: %+v", expect.FailedQueries, len(result.State.FailedQueries), result.State.FailedQueries))
+	}
+
+	for style, wants := range expect.Bibliography {
+		if result.State.Bibliography == nil {
+			errs = append(errs, fmt.Errorf("expected a %s bibliography, got none", style))
+			continue
+		}
+		exported, err := result.State.Bibliography.Format(style)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		for _, want := range wants {
+			if !strings.Contains(exported, want) {
+				errs = append(errs, fmt.Errorf("%s bibliography does not contain %q: %q", style, want, exported))
+			}
+		}
+	}
+
+	if len(expect.ClaimVerdicts) > 0 {
+		byVerdict := make(map[string]int)
+		for _, verdict := range result.State.ClaimVerdicts {
+			byVerdict[verdict.Verdict]++
+		}
+		for verdict, want := range expect.ClaimVerdicts {
+			if byVerdict[verdict] != want {
+				errs = append(errs, fmt.Errorf("expected %d %s claims, got %d: %+v", want, verdict, byVerdict[verdict], result.State.ClaimVerdicts))
+			}
+		}
+	}
+
+	if expect.DroppedSources != 0 {
+		dropped := 0
+		for _, decision := range result.State.SourceDecisions {
+			if !decision.Kept() {
+				dropped++
+			}
+		}
+		if dropped != expect.DroppedSources {
+			errs = append(errs, fmt.Errorf("expected %d dropped sources, got %d: %+v", expect.DroppedSources, dropped, result.State.SourceDecisions))
+		}
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,30 @@
+package agenttest
+
+import (
+	"context"
+	"testing"
+)
+
+func TestScenarios(t *testing.T) {
+	scenarios, err := LoadScenarios("testdata/*.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(scenarios) == 0 {
+		t.Fatal("no scenarios in testdata")
+	}
+	for _, scenario := range scenarios {
+		t.Run(scenario.Name, func(t *testing.T) {
+			result, err := scenario.Run(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := scenario.Check(result); err != nil {
+				t.Error(err)
+			}
+			if unused := result.Model.Unused(); len(unused) > 0 {
+				t.Errorf("%d scripted responses were never used, the first for node %q", len(unused), unused[0].Node)
+			}
+		})
+	}
+}
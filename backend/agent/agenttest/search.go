@@ -0,0 +1,79 @@
+package agenttest
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sync"
+
+	"github.com/zaynkorai/gemini-fullstack-langgraph-quickstart/agent"
+)
+
+// SearchScript is a scripted search result set. Match is a regular
+// expression on the query; an empty Match answers any query. Each entry
+// answers every matching query unless Once is set.
+type SearchScript struct {
+	Match   string               `json:"match,omitempty"`
+	Once    bool                 `json:"once,omitempty"`
+	Results []agent.SearchResult `json:"results,omitempty"`
+	Error   *InjectedError       `json:"error,omitempty"`
+
+	match *regexp.Regexp
+}
+
+// FakeSearch is an agent.SearchProvider that serves SearchScripts, for runs
+// that use a results-based provider instead of Gemini grounding.
+type FakeSearch struct {
+	mu      sync.Mutex
+	scripts []*SearchScript
+	used    []bool
+	queries []string
+}
+
+func NewFakeSearch(scripts ...SearchScript) (*FakeSearch, error) {
+	f := &FakeSearch{}
+	for i := range scripts {
+		s := scripts[i]
+		if s.Match != "" {
+			re, err := regexp.Compile(s.Match)
+			if err != nil {
+				return nil, fmt.Errorf("search script %d: invalid match pattern: %w", i, err)
+			}
+			s.match = re
+		}
+		f.scripts = append(f.scripts, &s)
+		f.used = append(f.used, false)
+	}
+	return f, nil
+}
+
+func (f *FakeSearch) Search(ctx context.Context, req agent.SearchRequest) (*agent.SearchResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.queries = append(f.queries, req.Query)
+	for i, s := range f.scripts {
+		if f.used[i] || (s.match != nil && !s.match.MatchString(req.Query)) {
+			continue
+		}
+		if s.Once {
+			f.used[i] = true
+		}
+		if s.Error != nil {
+			return nil, s.Error.err()
+		}
+		results := s.Results
+		if req.MaxResults > 0 && len(results) > req.MaxResults {
+			results = results[:req.MaxResults]
+		}
+		return &agent.SearchResponse{Results: results}, nil
+	}
+	return &agent.SearchResponse{}, nil
+}
+
+// Queries returns every query searched, in order.
+func (f *FakeSearch) Queries() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.queries...)
+}
@@ -0,0 +1,46 @@
+package agenttest
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// FakeWeb is an http.RoundTripper that serves fixed pages by URL, so page
+// fetching runs without the network. Bodies starting with "<" are served as
+// HTML and anything else as plain text; unknown URLs are 404s.
+type FakeWeb struct {
+	Pages map[string]string
+
+	mu        sync.Mutex
+	requested []string
+}
+
+func (w *FakeWeb) RoundTrip(req *http.Request) (*http.Response, error) {
+	w.mu.Lock()
+	w.requested = append(w.requested, req.URL.String())
+	w.mu.Unlock()
+
+	body, ok := w.Pages[req.URL.String()]
+	status, contentType := http.StatusOK, "text/plain; charset=utf-8"
+	switch {
+	case !ok:
+		status = http.StatusNotFound
+	case strings.HasPrefix(strings.TrimSpace(body), "<"):
+		contentType = "text/html; charset=utf-8"
+	}
+	return &http.Response{
+		StatusCode: status,
+		Header:     http.Header{"Content-Type": {contentType}},
+		Body:       io.NopCloser(strings.NewReader(body)),
+		Request:    req,
+	}, nil
+}
+
+// Requested returns every URL requested, in order, including robots.txt.
+func (w *FakeWeb) Requested() []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return append([]string(nil), w.requested...)
+}
@@ -0,0 +1,198 @@
+package agent
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Bibliography export styles, as accepted by Bibliography.Format.
+const (
+	BibliographyBibTeX  = "bibtex"
+	BibliographyCSLJSON = "csl-json"
+	BibliographyAPA     = "apa"
+	BibliographyMLA     = "mla"
+)
+
+// BibliographyEntry is one cited source. Number matches the source's marker
+// in the final answer.
+type BibliographyEntry struct {
+	Number   int       `json:"number"`
+	URL      string    `json:"url"`
+	Title    string    `json:"title"`
+	Site     string    `json:"site,omitempty"`
+	Accessed time.Time `json:"accessed"`
+}
+
+// Bibliography lists the sources cited by a final answer, in marker order.
+type Bibliography struct {
+	Entries []BibliographyEntry `json:"entries"`
+}
+
+// NewBibliography builds a bibliography from the sources returned by
+// CitationRegistry.Render, numbering each entry like its marker: the source
+// at index i is [i+1]. Repeats of a canonical URL are dropped. accessed is
+// the date the sources were read, in GetCurrentDate's format; an
+// unparsable date falls back to today.
+func NewBibliography(sources []CitationSource, accessed string) *Bibliography {
+	accessedDate, err := time.Parse("January 2, 2006", accessed)
+	if err != nil {
+		now := time.Now()
+		accessedDate = time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	}
+
+	bibliography := &Bibliography{}
+	seen := make(map[string]bool)
+	for i, source := range sources {
+		canonical := CanonicalURL(source.URL)
+		if canonical == "" || seen[canonical] {
+			continue
+		}
+		seen[canonical] = true
+
+		site := sourceDomain(SearchResult{URL: canonical, Title: source.Title})
+		title := source.Title
+		if title == "" {
+			title = site
+		}
+		if title == "" {
+			title = canonical
+		}
+		bibliography.Entries = append(bibliography.Entries, BibliographyEntry{
+			Number:   i + 1,
+			URL:      canonical,
+			Title:    title,
+			Site:     site,
+			Accessed: accessedDate,
+		})
+	}
+	return bibliography
+}
+
+// Format renders the bibliography in one of the Bibliography* styles.
+func (b *Bibliography) Format(style string) (string, error) {
+	switch style {
+	case BibliographyBibTeX:
+		return b.BibTeX(), nil
+	case BibliographyCSLJSON:
+		data, err := b.CSLJSON()
+		return string(data), err
+	case BibliographyAPA:
+		return b.APA(), nil
+	case BibliographyMLA:
+		return b.MLA(), nil
+	}
+	return "", fmt.Errorf("unknown bibliography style %q", style)
+}
+
+// BibTeX renders each entry as an @misc record keyed ref1, ref2, ... with
+// url and urldate fields.
+func (b *Bibliography) BibTeX() string {
+	var sb strings.Builder
+	for _, entry := range b.Entries {
+		fmt.Fprintf(&sb, "@misc{ref%d,\n", entry.Number)
+		fmt.Fprintf(&sb, "  title = {%s},\n", bibtexEscape(entry.Title))
+		if entry.Site != "" && entry.Site != entry.Title {
+			fmt.Fprintf(&sb, "  organization = {%s},\n", bibtexEscape(entry.Site))
+		}
+		fmt.Fprintf(&sb, "  howpublished = {\\url{%s}},\n", entry.URL)
+		fmt.Fprintf(&sb, "  url = {%s},\n", entry.URL)
+		fmt.Fprintf(&sb, "  urldate = {%s},\n", entry.Accessed.Format("2006-01-02"))
+		fmt.Fprintf(&sb, "  note = {Accessed: %s}\n", entry.Accessed.Format("2006-01-02"))
+		sb.WriteString("}\n")
+	}
+	return sb.String()
+}
+
+type cslDate struct {
+	DateParts [][]int `json:"date-parts"`
+}
+
+type cslItem struct {
+	ID             string  `json:"id"`
+	Type           string  `json:"type"`
+	CitationNumber string  `json:"citation-number"`
+	Title          string  `json:"title"`
+	ContainerTitle string  `json:"container-title,omitempty"`
+	URL            string  `json:"URL"`
+	Accessed       cslDate `json:"accessed"`
+}
+
+// CSLJSON renders the entries as a CSL-JSON array of webpage items.
+func (b *Bibliography) CSLJSON() ([]byte, error) {
+	items := make([]cslItem, 0, len(b.Entries))
+	for _, entry := range b.Entries {
+		item := cslItem{
+			ID:             fmt.Sprintf("ref%d", entry.Number),
+			Type:           "webpage",
+			CitationNumber: fmt.Sprint(entry.Number),
+			Title:          entry.Title,
+			URL:            entry.URL,
+			Accessed:       cslDate{DateParts: [][]int{{entry.Accessed.Year(), int(entry.Accessed.Month()), entry.Accessed.Day()}}},
+		}
+		if entry.Site != entry.Title {
+			item.ContainerTitle = entry.Site
+		}
+		items = append(items, item)
+	}
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(items); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// APA renders a numbered Markdown list in APA 7 webpage style. Sources have
+// no known author or publication date, so they are listed by title with
+// "n.d.".
+func (b *Bibliography) APA() string {
+	var sb strings.Builder
+	for _, entry := range b.Entries {
+		fmt.Fprintf(&sb, "%d. *%s*. (n.d.). ", entry.Number, markdownEscape(entry.Title))
+		if entry.Site != "" && entry.Site != entry.Title {
+			fmt.Fprintf(&sb, "%s. ", markdownEscape(entry.Site))
+		}
+		fmt.Fprintf(&sb, "Retrieved %s, from <%s>\n", entry.Accessed.Format("January 2, 2006"), entry.URL)
+	}
+	return sb.String()
+}
+
+// MLA renders a numbered Markdown list in MLA 9 webpage style.
+func (b *Bibliography) MLA() string {
+	var sb strings.Builder
+	for _, entry := range b.Entries {
+		fmt.Fprintf(&sb, "%d. \"%s.\" ", entry.Number, markdownEscape(strings.TrimSuffix(entry.Title, ".")))
+		if entry.Site != "" && entry.Site != entry.Title {
+			fmt.Fprintf(&sb, "*%s*, ", markdownEscape(entry.Site))
+		}
+		fmt.Fprintf(&sb, "%s. Accessed %s.\n", strings.TrimPrefix(strings.TrimPrefix(entry.URL, "https://"), "http://"), mlaDate(entry.Accessed))
+	}
+	return sb.String()
+}
+
+var mlaMonths = [...]string{"Jan.", "Feb.", "Mar.", "Apr.", "May", "June", "July", "Aug.", "Sept.", "Oct.", "Nov.", "Dec."}
+
+// mlaDate formats t as MLA does, e.g. "18 Oct. 2026".
+func mlaDate(t time.Time) string {
+	return fmt.Sprintf("%d %s %d", t.Day(), mlaMonths[t.Month()-1], t.Year())
+}
+
+var bibtexReplacer = strings.NewReplacer(
+	`\`, `\textbackslash{}`, "{", `\{`, "}", `\}`, "&", `\&`, "%", `\%`,
+	"$", `\$`, "#", `\#`, "_", `\_`, "~", `\textasciitilde{}`, "^", `\textasciicircum{}`,
+)
+
+func bibtexEscape(text string) string {
+	return bibtexReplacer.Replace(text)
+}
+
+var markdownReplacer = strings.NewReplacer(`\`, `\\`, "*", `\*`, "_", `\_`, "[", `\[`, "]", `\]`, "<", `\<`)
+
+func markdownEscape(text string) string {
+	return markdownReplacer.Replace(text)
+}
@@ -0,0 +1,86 @@
+package agent
+
+import (
+	"testing"
+	"time"
+)
+
+func testBibliography() *Bibliography {
+	return NewBibliography([]CitationSource{
+		{ID: 1, URL: "https://Example.com/Solar/?utm_source=feed#costs", Title: "Cost & Yield_2024: 50% {up} *new*"},
+		{ID: 2, URL: "https://example.com/Solar", Title: "Solar costs, again"},
+		{ID: 3, URL: "https://www.nrel.gov/pv"},
+	}, "October 18, 2026")
+}
+
+func TestNewBibliographyDedupsCanonicalURLs(t *testing.T) {
+	entries := testBibliography().Entries
+	accessed := time.Date(2026, time.October, 18, 0, 0, 0, 0, time.UTC)
+	want := []BibliographyEntry{
+		{Number: 1, URL: "https://example.com/Solar", Title: "Cost & Yield_2024: 50% {up} *new*", Site: "example.com", Accessed: accessed},
+		{Number: 3, URL: "https://www.nrel.gov/pv", Title: "nrel.gov", Site: "nrel.gov", Accessed: accessed},
+	}
+	if len(entries) != len(want) {
+		t.Fatalf("entries = %+v, want %+v", entries, want)
+	}
+	for i := range want {
+		if entries[i] != want[i] {
+			t.Errorf("entry %d = %+v, want %+v", i, entries[i], want[i])
+		}
+	}
+}
+
+func TestBibliographyBibTeX(t *testing.T) {
+	want := `@misc{ref1,
+  title = {Cost \& Yield\_2024: 50\% \{up\} *new*},
+  organization = {example.com},
+  howpublished = {\url{https://example.com/Solar}},
+  url = {https://example.com/Solar},
+  urldate = {2026-10-18},
+  note = {Accessed: 2026-10-18}
+}
+@misc{ref3,
+  title = {nrel.gov},
+  howpublished = {\url{https://www.nrel.gov/pv}},
+  url = {https://www.nrel.gov/pv},
+  urldate = {2026-10-18},
+  note = {Accessed: 2026-10-18}
+}
+`
+	if got := testBibliography().BibTeX(); got != want {
+		t.Errorf("BibTeX() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestBibliographyMLA(t *testing.T) {
+	want := `1. "Cost & Yield\_2024: 50% {up} \*new\*." *example.com*, example.com/Solar. Accessed 18 Oct. 2026.
+3. "nrel.gov." www.nrel.gov/pv. Accessed 18 Oct. 2026.
+`
+	got, err := testBibliography().Format(BibliographyMLA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != want {
+		t.Errorf("MLA() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestBibtexEscape(t *testing.T) {
+	tests := map[string]string{
+		`C:\path`:  `C:\textbackslash{}path`,
+		"#1 ~ 2^3": `\#1 \textasciitilde{} 2\textasciicircum{}3`,
+		"$5 & 10%": `\$5 \& 10\%`,
+		"plain":    "plain",
+	}
+	for in, want := range tests {
+		if got := bibtexEscape(in); got != want {
+			t.Errorf("bibtexEscape(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestBibliographyFormatUnknownStyle(t *testing.T) {
+	if _, err := testBibliography().Format("chicago"); err == nil {
+		t.Error("expected an error for an unknown style")
+	}
+}
@@ -0,0 +1,196 @@
+package agent
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// CacheStore persists cached responses by key. A zero ttl never expires.
+type CacheStore interface {
+	Get(key string) ([]byte, bool, error)
+	Set(key string, value []byte, ttl time.Duration) error
+}
+
+type cacheEntry struct {
+	ExpiresAt time.Time       `json:"expires_at,omitempty"`
+	Value     json.RawMessage `json:"value"`
+}
+
+func (e cacheEntry) expired() bool {
+	return !e.ExpiresAt.IsZero() && time.Now().After(e.ExpiresAt)
+}
+
+func newCacheEntry(value []byte, ttl time.Duration) cacheEntry {
+	entry := cacheEntry{Value: value}
+	if ttl > 0 {
+		entry.ExpiresAt = time.Now().Add(ttl)
+	}
+	return entry
+}
+
+type MemoryCache struct {
+	mu      sync.Mutex
+	entries map[string]cacheEntry
+}
+
+func NewMemoryCache() *MemoryCache {
+	return &MemoryCache{entries: make(map[string]cacheEntry)}
+}
+
+func (c *MemoryCache) Get(key string) ([]byte, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok {
+		return nil, false, nil
+	}
+	if entry.expired() {
+		delete(c.entries, key)
+		return nil, false, nil
+	}
+	return entry.Value, true, nil
+}
+
+func (c *MemoryCache) Set(key string, value []byte, ttl time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[key] = newCacheEntry(value, ttl)
+	return nil
+}
+
+// FileCache stores one JSON file per key under Dir, sharded by the first two
+// characters of the key.
+type FileCache struct {
+	Dir string
+}
+
+func (c *FileCache) path(key string) string {
+	return filepath.Join(c.Dir, key[:2], key+".json")
+}
+
+func (c *FileCache) Get(key string) ([]byte, bool, error) {
+	data, err := os.ReadFile(c.path(key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	var entry cacheEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil, false, fmt.Errorf("corrupt cache entry %s: %w", key, err)
+	}
+	if entry.expired() {
+		os.Remove(c.path(key))
+		return nil, false, nil
+	}
+	return entry.Value, true, nil
+}
+
+func (c *FileCache) Set(key string, value []byte, ttl time.Duration) error {
+	path := c.path(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	data, err := json.Marshal(newCacheEntry(value, ttl))
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, data)
+}
+
+// writeFileAtomic writes to a temporary file first and renames it into place
+// so concurrent readers never see a partial file.
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+type CacheStats struct {
+	Hits   int64
+	Misses int64
+}
+
+// CachedGenerator serves repeated requests from Store. Keys are a hash of the
+// model name and the full request, so any change to the prompt, tools or
+// generation config is a miss. A hit reports no usage, since no tokens were
+// spent on it, so cached calls do not count towards run budgets. With Bypass
+// set, lookups are skipped but fresh responses are still stored.
+type CachedGenerator struct {
+	Next   ContentGenerator
+	Store  CacheStore
+	TTL    time.Duration
+	Bypass bool
+
+	hits   atomic.Int64
+	misses atomic.Int64
+}
+
+func (g *CachedGenerator) GenerateContent(ctx context.Context, model string, req *GenerateContentRequest) (*GeminiResponse, error) {
+	key, err := cacheKey(model, req)
+	if err != nil {
+		return nil, err
+	}
+
+	if !g.Bypass {
+		if data, ok, err := g.Store.Get(key); err == nil && ok {
+			var response GeminiResponse
+			if err := json.Unmarshal(data, &response); err == nil {
+				g.hits.Add(1)
+				response.UsageMetadata = nil
+				response.Cached = true
+				return &response, nil
+			}
+		}
+	}
+	g.misses.Add(1)
+
+	response, err := g.Next.GenerateContent(ctx, model, req)
+	if err != nil {
+		return nil, err
+	}
+	if data, err := json.Marshal(response); err == nil {
+		g.Store.Set(key, data, g.TTL)
+	}
+	return response, nil
+}
+
+func (g *CachedGenerator) Stats() CacheStats {
+	return CacheStats{Hits: g.hits.Load(), Misses: g.misses.Load()}
+}
+
+func cacheKey(model string, req *GenerateContentRequest) (string, error) {
+	data, err := json.Marshal(struct {
+		Model   string                  `json:"model"`
+		Request *GenerateContentRequest `json:"request"`
+	}{model, req})
+	if err != nil {
+		return "", fmt.Errorf("failed to build cache key: %w", err)
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
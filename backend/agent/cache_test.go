@@ -0,0 +1,133 @@
+package agent
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// countingGenerator answers every call with text, "answer" by default.
+type countingGenerator struct {
+	calls int
+	text  string
+}
+
+func (g *countingGenerator) GenerateContent(ctx context.Context, model string, req *GenerateContentRequest) (*GeminiResponse, error) {
+	g.calls++
+	text := g.text
+	if text == "" {
+		text = "answer"
+	}
+	return &GeminiResponse{
+		Candidates:    []GeminiCandidate{{Content: Content{Role: "model", Parts: []Part{{Text: text}}}, FinishReason: FinishReasonStop}},
+		Text:          text,
+		UsageMetadata: &UsageMetadata{PromptTokenCount: 10, CandidatesTokenCount: 5, TotalTokenCount: 15},
+	}, nil
+}
+
+func textRequest(text string) *GenerateContentRequest {
+	return &GenerateContentRequest{Contents: []Content{{Role: "user", Parts: []Part{{Text: text}}}}}
+}
+
+func TestCachedGeneratorServesRepeatsWithoutUsage(t *testing.T) {
+	next := &countingGenerator{}
+	cached := &CachedGenerator{Next: next, Store: NewMemoryCache()}
+
+	first, err := cached.GenerateContent(context.Background(), "m", textRequest("q"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.UsageMetadata == nil {
+		t.Fatal("a miss lost its usage")
+	}
+	second, err := cached.GenerateContent(context.Background(), "m", textRequest("q"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second.Text != "answer" || second.UsageMetadata != nil || !second.Cached {
+		t.Errorf("hit = %q with usage %+v, cached %v, want the cached text and no usage", second.Text, second.UsageMetadata, second.Cached)
+	}
+
+	if _, err := cached.GenerateContent(context.Background(), "other", textRequest("q")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cached.GenerateContent(context.Background(), "m", textRequest("q2")); err != nil {
+		t.Fatal(err)
+	}
+	if next.calls != 3 {
+		t.Errorf("expected 3 calls to the model, got %d", next.calls)
+	}
+	if stats := cached.Stats(); stats != (CacheStats{Hits: 1, Misses: 3}) {
+		t.Errorf("Stats() = %+v", stats)
+	}
+}
+
+func TestRunUsageCountsCacheLookups(t *testing.T) {
+	config := NewConfiguration()
+	config.Cache = "memory"
+	nodes := NewNodesWithClient(config, &countingGenerator{text: `{"rationale": "r", "query": ["q"]}`})
+
+	for _, want := range []RunUsage{
+		{CacheMisses: 1, Total: UsageMetadata{PromptTokenCount: 10, CandidatesTokenCount: 5, TotalTokenCount: 15}},
+		{CacheHits: 1},
+	} {
+		state := &OverallState{Messages: []Message{HumanMessage{Content: "What is the capital of France?"}}}
+		if _, _, err := nodes.GenerateQueryNode(context.Background(), state); err != nil {
+			t.Fatal(err)
+		}
+		got := state.Usage
+		if got.CacheHits != want.CacheHits || got.CacheMisses != want.CacheMisses || got.Total != want.Total {
+			t.Errorf("usage = %d hits, %d misses, %+v, want %d hits, %d misses, %+v",
+				got.CacheHits, got.CacheMisses, got.Total, want.CacheHits, want.CacheMisses, want.Total)
+		}
+	}
+}
+
+func TestCachedGeneratorBypass(t *testing.T) {
+	next := &countingGenerator{}
+	store := NewMemoryCache()
+	bypass := &CachedGenerator{Next: next, Store: store, Bypass: true}
+	for i := 0; i < 2; i++ {
+		if _, err := bypass.GenerateContent(context.Background(), "m", textRequest("q")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if next.calls != 2 {
+		t.Errorf("expected bypass to call the model every time, got %d calls", next.calls)
+	}
+
+	cached := &CachedGenerator{Next: next, Store: store}
+	if _, err := cached.GenerateContent(context.Background(), "m", textRequest("q")); err != nil {
+		t.Fatal(err)
+	}
+	if next.calls != 2 {
+		t.Error("response stored while bypassing was not served")
+	}
+}
+
+func TestFileCache(t *testing.T) {
+	cache := &FileCache{Dir: t.TempDir()}
+	key, err := cacheKey("m", textRequest("q"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok, err := cache.Get(key); ok || err != nil {
+		t.Fatalf("Get() on an empty cache = %v, %v", ok, err)
+	}
+	if err := cache.Set(key, []byte(`{"text":"answer"}`), time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	value, ok, err := cache.Get(key)
+	if !ok || err != nil || string(value) != `{"text":"answer"}` {
+		t.Fatalf("Get() = %s, %v, %v", value, ok, err)
+	}
+
+	if err := cache.Set(key, []byte(`{}`), time.Nanosecond); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(time.Millisecond)
+	if _, ok, _ := cache.Get(key); ok {
+		t.Error("expired entry was served")
+	}
+}
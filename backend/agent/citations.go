@@ -0,0 +1,261 @@
+package agent
+
+import (
+	"fmt"
+	"html"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const citationURLPrefix = "https://vertexaisearch.cloud.google.com/id/"
+
+var citationURLPattern = regexp.MustCompile(`https://vertexaisearch\.cloud\.google\.com/id/(\d+)`)
+
+// CitationSource is one distinct source cited during a run.
+type CitationSource struct {
+	ID       int    `json:"id"`
+	URL      string `json:"url"`
+	Title    string `json:"title,omitempty"`
+	ShortURL string `json:"short_url"`
+}
+
+// CitationRegistry gives every distinct source in a run a short URL for the
+// models to cite, numbered from 1 in the order sources are first seen. A
+// source keeps its ID for the rest of the run, so summaries from different
+// research loops never reuse one. Sources are keyed by CanonicalURL. It is
+// safe for concurrent use.
+type CitationRegistry struct {
+	mu      sync.Mutex
+	sources []CitationSource
+	byURL   map[string]int
+}
+
+func NewCitationRegistry() *CitationRegistry {
+	return &CitationRegistry{byURL: make(map[string]int)}
+}
+
+// Register returns the source for rawURL, adding it if it is new. A title
+// fills in one that was not known when the source was first registered.
+func (r *CitationRegistry) Register(rawURL, title string) CitationSource {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	canonical := CanonicalURL(rawURL)
+	if i, ok := r.byURL[canonical]; ok {
+		if r.sources[i].Title == "" {
+			r.sources[i].Title = title
+		}
+		return r.sources[i]
+	}
+	id := len(r.sources) + 1
+	r.sources = append(r.sources, CitationSource{
+		ID:       id,
+		URL:      canonical,
+		Title:    title,
+		ShortURL: citationURLPrefix + strconv.Itoa(id),
+	})
+	r.byURL[canonical] = id - 1
+	return r.sources[id-1]
+}
+
+// Lookup returns the source with the given short URL.
+func (r *CitationRegistry) Lookup(shortURL string) (CitationSource, bool) {
+	match := citationURLPattern.FindStringSubmatch(shortURL)
+	if match == nil || match[0] != shortURL {
+		return CitationSource{}, false
+	}
+	id, _ := strconv.Atoi(match[1])
+	return r.byID(id)
+}
+
+func (r *CitationRegistry) byID(id int) (CitationSource, bool) {
+	if r == nil {
+		return CitationSource{}, false
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if id < 1 || id > len(r.sources) {
+		return CitationSource{}, false
+	}
+	return r.sources[id-1], true
+}
+
+// Sources returns every registered source in ID order.
+func (r *CitationRegistry) Sources() []CitationSource {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]CitationSource(nil), r.sources...)
+}
+
+// Resolve replaces the short URLs in text with their sources' URLs and
+// returns the sources cited, in order of first citation. Short URLs the
+// registry does not know are left as they are.
+func (r *CitationRegistry) Resolve(text string) (string, []CitationSource) {
+	var cited []CitationSource
+	seen := make(map[int]bool)
+	resolved := citationURLPattern.ReplaceAllStringFunc(text, func(shortURL string) string {
+		id, _ := strconv.Atoi(strings.TrimPrefix(shortURL, citationURLPrefix))
+		source, ok := r.byID(id)
+		if !ok {
+			return shortURL
+		}
+		if !seen[id] {
+			seen[id] = true
+			cited = append(cited, source)
+		}
+		return source.URL
+	})
+	return resolved, cited
+}
+
+// Citation marker formats, as named by Configuration.CitationFormat.
+const (
+	CitationFormatMarkdown = "markdown"
+	CitationFormatFootnote = "footnote"
+	CitationFormatHTML     = "html"
+)
+
+// MarkerFormat renders citation markers. Marker renders one cited source,
+// where number counts distinct sources from 1 in order of first citation.
+// References returns text to append after a final answer, such as footnote
+// definitions, or "".
+type MarkerFormat interface {
+	Marker(label, href string, number int) string
+	References(sources []CitationSource) string
+}
+
+// MarkdownMarkers writes inline Markdown links: [label](href).
+type MarkdownMarkers struct{}
+
+func (MarkdownMarkers) Marker(label, href string, number int) string {
+	return fmt.Sprintf("[%s](%s)", label, href)
+}
+
+func (MarkdownMarkers) References(sources []CitationSource) string { return "" }
+
+// FootnoteMarkers writes numeric markers, [1], and lists the sources as
+// Markdown reference definitions so the markers render as links.
+type FootnoteMarkers struct{}
+
+func (FootnoteMarkers) Marker(label, href string, number int) string {
+	return fmt.Sprintf("[%d]", number)
+}
+
+func (FootnoteMarkers) References(sources []CitationSource) string {
+	var sb strings.Builder
+	for i, source := range sources {
+		fmt.Fprintf(&sb, "\n[%d]: %s", i+1, source.URL)
+		if source.Title != "" {
+			fmt.Fprintf(&sb, " %q", source.Title)
+		}
+	}
+	return sb.String()
+}
+
+// HTMLMarkers writes superscript numeric links: <sup><a href="...">1</a></sup>.
+type HTMLMarkers struct{}
+
+func (HTMLMarkers) Marker(label, href string, number int) string {
+	return fmt.Sprintf(`<sup><a href="%s" title="%s">%d</a></sup>`, html.EscapeString(href), html.EscapeString(label), number)
+}
+
+func (HTMLMarkers) References(sources []CitationSource) string { return "" }
+
+// MarkerFormatByName returns the format for a CitationFormat name. An empty
+// name selects Markdown links.
+func MarkerFormatByName(name string) (MarkerFormat, error) {
+	switch name {
+	case "", CitationFormatMarkdown:
+		return MarkdownMarkers{}, nil
+	case CitationFormatFootnote:
+		return FootnoteMarkers{}, nil
+	case CitationFormatHTML:
+		return HTMLMarkers{}, nil
+	}
+	return nil, fmt.Errorf("unknown citation format %q", name)
+}
+
+// citationLinkPattern matches a Markdown link to a short URL.
+var citationLinkPattern = regexp.MustCompile(`\[([^\[\]]*)\]\((https://vertexaisearch\.cloud\.google\.com/id/\d+)\)`)
+
+// Render rewrites the Markdown citation links in a final answer with format,
+// numbering sources in order of first citation, resolves any remaining short
+// URLs and appends the format's references. It returns the sources cited, in
+// marker order.
+func (r *CitationRegistry) Render(text string, format MarkerFormat) (string, []CitationSource) {
+	var cited []CitationSource
+	numbers := make(map[int]int)
+	cite := func(source CitationSource) int {
+		if numbers[source.ID] == 0 {
+			cited = append(cited, source)
+			numbers[source.ID] = len(cited)
+		}
+		return numbers[source.ID]
+	}
+
+	text = citationLinkPattern.ReplaceAllStringFunc(text, func(link string) string {
+		match := citationLinkPattern.FindStringSubmatch(link)
+		source, ok := r.Lookup(match[2])
+		if !ok {
+			return link
+		}
+		return format.Marker(match[1], source.URL, cite(source))
+	})
+	text, bare := r.Resolve(text)
+	for _, source := range bare {
+		cite(source)
+	}
+	if references := format.References(cited); references != "" {
+		text = strings.TrimRight(text, "\n") + "\n" + references
+	}
+	return text, cited
+}
+
+// trackingParams are query parameters that identify a referral rather than
+// a page, so CanonicalURL drops them.
+var trackingParams = regexp.MustCompile(`^(utm_.*|fbclid|gclid|mc_cid|mc_eid)$`)
+
+// CanonicalURL normalises a URL so the same page reached by different links
+// compares equal: the scheme and host are lowercased, default ports,
+// fragments, tracking parameters and trailing slashes are dropped, and the
+// remaining query parameters are sorted. Values that are not absolute URLs,
+// such as local corpus paths, are only trimmed.
+func CanonicalURL(rawURL string) string {
+	rawURL = strings.TrimSpace(rawURL)
+	parsed, err := url.Parse(rawURL)
+	if err != nil || parsed.Scheme == "" || parsed.Host == "" {
+		return rawURL
+	}
+	parsed.Scheme = strings.ToLower(parsed.Scheme)
+	host := strings.ToLower(parsed.Hostname())
+	if port := parsed.Port(); port != "" && !(parsed.Scheme == "http" && port == "80") && !(parsed.Scheme == "https" && port == "443") {
+		host += ":" + port
+	}
+	parsed.Host = host
+	parsed.Fragment = ""
+	parsed.RawFragment = ""
+
+	if parsed.RawQuery != "" {
+		query := parsed.Query()
+		for key := range query {
+			if trackingParams.MatchString(strings.ToLower(key)) {
+				delete(query, key)
+			}
+		}
+		parsed.RawQuery = query.Encode()
+	}
+	if len(parsed.Path) > 1 {
+		parsed.Path = strings.TrimRight(parsed.Path, "/")
+		parsed.RawPath = strings.TrimRight(parsed.RawPath, "/")
+	}
+	if parsed.Path == "" {
+		parsed.Path = "/"
+	}
+	return parsed.String()
+}
@@ -1,8 +1,12 @@
 package agent
 
 import (
+	"io/fs"
+	"net/http"
 	"os"
 	"strconv"
+	"strings"
+	"time"
 )
 
 type RunnableConfig struct {
@@ -14,6 +18,122 @@ type Configuration struct {
 	ReasoningModel         string
 	NumberOfInitialQueries int
 	MaxResearchLoops       int
+
+	// QueryGeneratorModels, ReflectionModels and AnswerModels are ordered
+	// fallback chains per role. When empty, the role uses
+	// QueryGeneratorModel or ReasoningModel alone.
+	QueryGeneratorModels []string
+	ReflectionModels     []string
+	AnswerModels         []string
+
+	// SearchProvider selects the web search backend: "gemini" (Google Search
+	// grounding, the default), "searxng", "brave", "tavily" or "local".
+	// SearchBaseURL overrides the provider's endpoint and is required for
+	// SearxNG.
+	SearchProvider   string
+	SearchBaseURL    string
+	SearchAPIKey     string
+	MaxSearchResults int
+
+	// CitationFormat sets how the final answer marks citations: "markdown"
+	// links (the default), numeric "footnote" references or "html"
+	// superscripts.
+	CitationFormat string
+
+	// VerifyClaims checks each claim in the final answer against the
+	// research: "annotate" marks the claims the sources do not support and
+	// "rewrite" rewrites or removes them. Empty disables verification.
+	VerifyClaims string
+
+	// MaxParallelQueries bounds how many queries WebResearchNode searches
+	// at once.
+	MaxParallelQueries int
+
+	// CorpusDir is the document directory searched by the "local" provider.
+	// Its index is persisted at CorpusIndexPath.
+	CorpusDir       string
+	CorpusIndexPath string
+
+	// FetchPages downloads the top MaxFetchPages results of each query and
+	// adds their main text to the web research summary. Fetches honour
+	// robots.txt, wait FetchDelay between requests to one host and are
+	// bounded by FetchTimeout and FetchMaxBytes.
+	FetchPages    bool
+	MaxFetchPages int
+	FetchDelay    time.Duration
+	FetchTimeout  time.Duration
+	FetchMaxBytes int64
+
+	// Follow-up queries that repeat an earlier query in the run are skipped.
+	// Queries always match when their normalised terms are equal; with a
+	// QueryEmbedder ("hashing" or "gemini") they also match when their
+	// cosine similarity reaches QueryDedupThreshold.
+	QueryEmbedder       string
+	QueryDedupThreshold float64
+
+	// AllowedDomains and DeniedDomains restrict which sources research may
+	// cite, and DomainWeights ranks the rest by credibility. Sources weighted
+	// below MinDomainWeight are dropped. See DomainPolicy for the pattern
+	// syntax.
+	AllowedDomains  []string
+	DeniedDomains   []string
+	DomainWeights   map[string]float64
+	MinDomainWeight float64
+
+	// ReflectionThinking and AnswerThinking set the thinking budget and
+	// thought summaries for the reflection and answer roles. They are only
+	// sent to models that support thinking.
+	ReflectionThinking ThinkingConfig
+	AnswerThinking     ThinkingConfig
+
+	// RateLimits caps calls per model name, including the embedding model,
+	// and per search provider name ("searxng", "brave" or "tavily"). The
+	// DefaultRateLimitKey entry applies to those that are not listed.
+	RateLimits map[string]RateLimit
+
+	// Cache selects the response cache backend: "" (disabled), "memory" or
+	// "file". The file backend stores entries under CacheDir. Entries expire
+	// after CacheTTL; zero keeps them until they are overwritten.
+	Cache       string
+	CacheDir    string
+	CacheTTL    time.Duration
+	CacheBypass bool
+
+	// Prices is the per-model price table used for cost estimates.
+	// MaxRunTokens and MaxRunCost stop the research loop once a run has
+	// spent that much; zero disables the limit.
+	Prices       map[string]ModelPrice
+	MaxRunTokens int
+	MaxRunCost   float64
+
+	// Tools names the built-in tools the answer model may call, e.g.
+	// "calculator", "current_date" and "fetch_url". MaxToolSteps bounds the
+	// number of model turns in the tool-calling loop.
+	Tools        []string
+	MaxToolSteps int
+
+	// SafetySettings are sent with every model call. SAFETY_THRESHOLD sets
+	// the same threshold for all HarmCategories.
+	SafetySettings []SafetySetting
+
+	// VertexProject switches model calls from the Gemini API to Vertex AI in
+	// VertexLocation, authenticated with the service-account key in
+	// ServiceAccountFile. TokenURL overrides the OAuth2 token endpoint.
+	VertexProject      string
+	VertexLocation     string
+	ServiceAccountFile string
+	TokenURL           string
+
+	// PromptDir, or PromptFS when set, holds prompt overrides loaded by
+	// LoadPromptRegistry. PromptSet selects the set used for the run.
+	PromptDir string
+	PromptFS  fs.FS
+	PromptSet string
+
+	// HTTPClient, when set, carries model, OAuth2 token and search provider
+	// requests, e.g. to record or replay them. Like PromptFS it can only be
+	// set in code.
+	HTTPClient *http.Client
 }
 
 func NewConfiguration() *Configuration {
@@ -22,6 +142,18 @@ func NewConfiguration() *Configuration {
 		ReasoningModel:         "gemini-2.5-flash-preview-04-17",
 		NumberOfInitialQueries: 3,
 		MaxResearchLoops:       2,
+		CacheDir:               ".cache/llm",
+		Prices:                 DefaultModelPrices,
+		MaxToolSteps:           defaultMaxToolSteps,
+		SearchProvider:         SearchProviderGemini,
+		MaxSearchResults:       defaultMaxResults,
+		MaxParallelQueries:     defaultMaxParallelQueries,
+		CorpusIndexPath:        ".cache/corpus/index.json",
+		MaxFetchPages:          defaultMaxFetchPages,
+		FetchDelay:             defaultFetchDelay,
+		FetchTimeout:           defaultFetchTimeout,
+		FetchMaxBytes:          defaultFetchMaxBytes,
+		QueryDedupThreshold:    defaultQueryDedupThreshold,
 	}
 }
 
@@ -52,10 +184,172 @@ func (c *Configuration) FromRunnableConfig(config *RunnableConfig) *Configuratio
 		return defaultValue
 	}
 
+	getFloat := func(envVar, configKey string, defaultValue float64) float64 {
+		if val := os.Getenv(envVar); val != "" {
+			if floatVal, err := strconv.ParseFloat(val, 64); err == nil {
+				return floatVal
+			}
+		}
+		if configurableVal, ok := config.Configurable[configKey].(float64); ok {
+			return configurableVal
+		}
+		return defaultValue
+	}
+
+	getBool := func(envVar, configKey string, defaultValue bool) bool {
+		if val := os.Getenv(envVar); val != "" {
+			if boolVal, err := strconv.ParseBool(val); err == nil {
+				return boolVal
+			}
+		}
+		if configurableVal, ok := config.Configurable[configKey].(bool); ok {
+			return configurableVal
+		}
+		return defaultValue
+	}
+
+	getDuration := func(envVar, configKey string, defaultValue time.Duration) time.Duration {
+		if val := getString(envVar, configKey, ""); val != "" {
+			if duration, err := time.ParseDuration(val); err == nil {
+				return duration
+			}
+		}
+		return defaultValue
+	}
+
 	c.QueryGeneratorModel = getString("QUERY_GENERATOR_MODEL", "query_generator_model", c.QueryGeneratorModel)
 	c.ReasoningModel = getString("REASONING_MODEL", "reasoning_model", c.ReasoningModel)
 	c.NumberOfInitialQueries = getInt("NUMBER_OF_INITIAL_QUERIES", "number_of_initial_queries", c.NumberOfInitialQueries)
 	c.MaxResearchLoops = getInt("MAX_RESEARCH_LOOPS", "max_research_loops", c.MaxResearchLoops)
+	c.MaxRunTokens = getInt("MAX_RUN_TOKENS", "max_run_tokens", c.MaxRunTokens)
+	c.MaxRunCost = getFloat("MAX_RUN_COST", "max_run_cost", c.MaxRunCost)
+	getOptionalInt := func(envVar, configKey string, defaultValue *int) *int {
+		if val := os.Getenv(envVar); val != "" {
+			if intVal, err := strconv.Atoi(val); err == nil {
+				return &intVal
+			}
+		}
+		if configurableVal, ok := config.Configurable[configKey].(float64); ok {
+			intVal := int(configurableVal)
+			return &intVal
+		}
+		return defaultValue
+	}
+
+	c.ReflectionThinking.ThinkingBudget = getOptionalInt("REFLECTION_THINKING_BUDGET", "reflection_thinking_budget", c.ReflectionThinking.ThinkingBudget)
+	c.ReflectionThinking.IncludeThoughts = getBool("REFLECTION_INCLUDE_THOUGHTS", "reflection_include_thoughts", c.ReflectionThinking.IncludeThoughts)
+	c.AnswerThinking.ThinkingBudget = getOptionalInt("ANSWER_THINKING_BUDGET", "answer_thinking_budget", c.AnswerThinking.ThinkingBudget)
+	c.AnswerThinking.IncludeThoughts = getBool("ANSWER_INCLUDE_THOUGHTS", "answer_include_thoughts", c.AnswerThinking.IncludeThoughts)
+
+	getList := func(envVar, configKey string, defaultValue []string) []string {
+		if val := getString(envVar, configKey, ""); val != "" {
+			var list []string
+			for _, item := range strings.Split(val, ",") {
+				if item = strings.TrimSpace(item); item != "" {
+					list = append(list, item)
+				}
+			}
+			return list
+		}
+		return defaultValue
+	}
+
+	c.QueryGeneratorModels = getList("QUERY_GENERATOR_MODELS", "query_generator_models", c.QueryGeneratorModels)
+	c.ReflectionModels = getList("REFLECTION_MODELS", "reflection_models", c.ReflectionModels)
+	c.AnswerModels = getList("ANSWER_MODELS", "answer_models", c.AnswerModels)
+	if threshold := getString("SAFETY_THRESHOLD", "safety_threshold", ""); threshold != "" {
+		c.SafetySettings = SafetySettingsForThreshold(threshold)
+	}
+	c.Tools = getList("AGENT_TOOLS", "tools", c.Tools)
+	c.AllowedDomains = getList("ALLOWED_DOMAINS", "allowed_domains", c.AllowedDomains)
+	c.DeniedDomains = getList("DENIED_DOMAINS", "denied_domains", c.DeniedDomains)
+	if weights := getList("DOMAIN_WEIGHTS", "domain_weights", nil); weights != nil {
+		c.DomainWeights = make(map[string]float64)
+		for _, entry := range weights {
+			pattern, value, _ := strings.Cut(entry, "=")
+			if weight, err := strconv.ParseFloat(strings.TrimSpace(value), 64); err == nil {
+				c.DomainWeights[strings.TrimSpace(pattern)] = weight
+			}
+		}
+	}
+	c.MinDomainWeight = getFloat("MIN_DOMAIN_WEIGHT", "min_domain_weight", c.MinDomainWeight)
+	c.MaxToolSteps = getInt("MAX_TOOL_STEPS", "max_tool_steps", c.MaxToolSteps)
+	c.Cache = getString("LLM_CACHE", "cache", c.Cache)
+	c.CacheDir = getString("LLM_CACHE_DIR", "cache_dir", c.CacheDir)
+	c.CacheTTL = getDuration("LLM_CACHE_TTL", "cache_ttl", c.CacheTTL)
+	c.CacheBypass = getBool("LLM_CACHE_BYPASS", "cache_bypass", c.CacheBypass)
+	c.SearchProvider = getString("SEARCH_PROVIDER", "search_provider", c.SearchProvider)
+	c.SearchBaseURL = getString("SEARCH_BASE_URL", "search_base_url", c.SearchBaseURL)
+	c.SearchAPIKey = getString("SEARCH_API_KEY", "search_api_key", c.SearchAPIKey)
+	c.CorpusDir = getString("CORPUS_DIR", "corpus_dir", c.CorpusDir)
+	c.CorpusIndexPath = getString("CORPUS_INDEX_PATH", "corpus_index_path", c.CorpusIndexPath)
+	c.MaxSearchResults = getInt("MAX_SEARCH_RESULTS", "max_search_results", c.MaxSearchResults)
+	c.CitationFormat = getString("CITATION_FORMAT", "citation_format", c.CitationFormat)
+	c.VerifyClaims = getString("VERIFY_CLAIMS", "verify_claims", c.VerifyClaims)
+	c.MaxParallelQueries = getInt("MAX_PARALLEL_QUERIES", "max_parallel_queries", c.MaxParallelQueries)
+	c.FetchPages = getBool("FETCH_PAGES", "fetch_pages", c.FetchPages)
+	c.MaxFetchPages = getInt("MAX_FETCH_PAGES", "max_fetch_pages", c.MaxFetchPages)
+	c.FetchDelay = getDuration("FETCH_DELAY", "fetch_delay", c.FetchDelay)
+	c.FetchTimeout = getDuration("FETCH_TIMEOUT", "fetch_timeout", c.FetchTimeout)
+	c.FetchMaxBytes = int64(getInt("FETCH_MAX_BYTES", "fetch_max_bytes", int(c.FetchMaxBytes)))
+	c.QueryEmbedder = getString("QUERY_EMBEDDER", "query_embedder", c.QueryEmbedder)
+	c.QueryDedupThreshold = getFloat("QUERY_DEDUP_THRESHOLD", "query_dedup_threshold", c.QueryDedupThreshold)
+	c.VertexProject = getString("GOOGLE_CLOUD_PROJECT", "vertex_project", c.VertexProject)
+	c.VertexLocation = getString("GOOGLE_CLOUD_LOCATION", "vertex_location", c.VertexLocation)
+	c.ServiceAccountFile = getString("GOOGLE_APPLICATION_CREDENTIALS", "service_account_file", c.ServiceAccountFile)
+	c.TokenURL = getString("VERTEX_TOKEN_URL", "token_url", c.TokenURL)
+	c.PromptDir = getString("PROMPT_DIR", "prompt_dir", c.PromptDir)
+	c.PromptSet = getString("PROMPT_SET", "prompt_set", c.PromptSet)
 
 	return c
 }
+
+// budgetExceeded reports whether usage has reached MaxRunTokens or MaxRunCost.
+func (c *Configuration) budgetExceeded(usage RunUsage) bool {
+	if c.MaxRunTokens > 0 && usage.Total.TotalTokenCount >= c.MaxRunTokens {
+		return true
+	}
+	return c.MaxRunCost > 0 && usage.EstimatedCost >= c.MaxRunCost
+}
+
+// promptRegistry loads the prompt overrides named by PromptFS or PromptDir.
+func (c *Configuration) promptRegistry() (*PromptRegistry, error) {
+	switch {
+	case c.PromptFS != nil:
+		return LoadPromptRegistry(c.PromptFS)
+	case c.PromptDir != "":
+		return LoadPromptRegistry(os.DirFS(c.PromptDir))
+	}
+	return NewPromptRegistry(), nil
+}
+
+func (c *Configuration) queryGeneratorChain() []string {
+	return modelChain(c.QueryGeneratorModels, c.QueryGeneratorModel, "")
+}
+
+func (c *Configuration) reflectionChain(override string) []string {
+	return modelChain(c.ReflectionModels, c.ReasoningModel, override)
+}
+
+func (c *Configuration) answerChain(override string) []string {
+	return modelChain(c.AnswerModels, c.ReasoningModel, override)
+}
+
+// modelChain returns chain, or just primary when chain is empty. A per-run
+// override is moved to the front.
+func modelChain(chain []string, primary, override string) []string {
+	models := chain
+	if len(models) == 0 {
+		models = []string{primary}
+	}
+	if override == "" {
+		return models
+	}
+	result := []string{override}
+	for _, model := range models {
+		if model != override {
+			result = append(result, model)
+		}
+	}
+	return result
+}
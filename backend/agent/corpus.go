@@ -0,0 +1,440 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+)
+
+const (
+	SearchProviderLocal = "local"
+
+	corpusIndexVersion = 1
+
+	// passageChars is the target passage size. Paragraphs are packed into
+	// passages up to this length; longer paragraphs are split on words.
+	passageChars = 800
+
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+var corpusExtensions = map[string]bool{
+	".md": true, ".markdown": true, ".txt": true, ".html": true, ".htm": true,
+}
+
+var stopWords = map[string]bool{
+	"a": true, "an": true, "and": true, "are": true, "as": true, "at": true,
+	"be": true, "by": true, "for": true, "from": true, "how": true, "in": true,
+	"is": true, "it": true, "of": true, "on": true, "or": true, "that": true,
+	"the": true, "this": true, "to": true, "was": true, "what": true, "when": true,
+	"where": true, "which": true, "who": true, "why": true, "with": true,
+}
+
+// corpusPassage is a chunk of a document with its term frequencies.
+type corpusPassage struct {
+	Text   string         `json:"text"`
+	Terms  map[string]int `json:"terms"`
+	Length int            `json:"length"`
+}
+
+type corpusDocument struct {
+	ModTime  time.Time       `json:"mod_time"`
+	Size     int64           `json:"size"`
+	Title    string          `json:"title"`
+	Passages []corpusPassage `json:"passages"`
+}
+
+// corpusIndex is the persisted form of the index: documents keyed by their
+// slash-separated path relative to the corpus directory. Postings are
+// rebuilt from it in memory.
+type corpusIndex struct {
+	Version   int                        `json:"version"`
+	Documents map[string]*corpusDocument `json:"documents"`
+}
+
+type passageRef struct {
+	path  string
+	index int
+}
+
+// LocalSearchProvider searches a directory of Markdown, HTML and plain-text
+// files with BM25 over passages. The index is persisted to IndexPath and
+// brought up to date with the directory before each search, re-reading only
+// files whose size or modification time changed. Results cite the file path
+// relative to Dir.
+type LocalSearchProvider struct {
+	Dir       string
+	IndexPath string
+
+	// RefreshInterval skips re-scanning Dir when the last scan is more
+	// recent. Zero scans before every search.
+	RefreshInterval time.Duration
+
+	mu         sync.Mutex
+	index      corpusIndex
+	postings   map[string][]posting
+	lengths    map[passageRef]int
+	avgLength  float64
+	lastSynced time.Time
+}
+
+type posting struct {
+	ref passageRef
+	tf  int
+}
+
+// NewLocalSearchProvider loads the index at indexPath, if any, and syncs it
+// with dir. An empty indexPath keeps the index in memory only.
+func NewLocalSearchProvider(dir, indexPath string) (*LocalSearchProvider, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open corpus directory: %w", err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("corpus path %s is not a directory", dir)
+	}
+
+	p := &LocalSearchProvider{Dir: dir, IndexPath: indexPath}
+	p.index = corpusIndex{Version: corpusIndexVersion, Documents: make(map[string]*corpusDocument)}
+	if indexPath != "" {
+		data, err := os.ReadFile(indexPath)
+		switch {
+		case errors.Is(err, fs.ErrNotExist):
+		case err != nil:
+			return nil, fmt.Errorf("failed to read corpus index: %w", err)
+		default:
+			var index corpusIndex
+			// A corrupt or outdated index is rebuilt from scratch.
+			if json.Unmarshal(data, &index) == nil && index.Version == corpusIndexVersion && index.Documents != nil {
+				p.index = index
+			}
+		}
+	}
+
+	if err := p.Sync(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Sync re-indexes files that were added, changed or removed since the last
+// sync and saves the index if anything changed.
+func (p *LocalSearchProvider) Sync() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.sync()
+}
+
+func (p *LocalSearchProvider) sync() error {
+	seen := make(map[string]bool)
+	changed := false
+	err := filepath.WalkDir(p.Dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			if path != p.Dir && strings.HasPrefix(entry.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !corpusExtensions[strings.ToLower(filepath.Ext(path))] {
+			return nil
+		}
+
+		rel, err := filepath.Rel(p.Dir, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		seen[rel] = true
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		if doc, ok := p.index.Documents[rel]; ok && doc.Size == info.Size() && doc.ModTime.Equal(info.ModTime()) {
+			return nil
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		p.index.Documents[rel] = parseCorpusDocument(rel, data, info)
+		changed = true
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to index corpus: %w", err)
+	}
+
+	for rel := range p.index.Documents {
+		if !seen[rel] {
+			delete(p.index.Documents, rel)
+			changed = true
+		}
+	}
+	p.lastSynced = time.Now()
+
+	if changed || p.postings == nil {
+		p.buildPostings()
+	}
+	if changed && p.IndexPath != "" {
+		return p.save()
+	}
+	return nil
+}
+
+func (p *LocalSearchProvider) save() error {
+	data, err := json.Marshal(p.index)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p.IndexPath), 0o755); err != nil {
+		return err
+	}
+	if err := writeFileAtomic(p.IndexPath, data); err != nil {
+		return fmt.Errorf("failed to save corpus index: %w", err)
+	}
+	return nil
+}
+
+func (p *LocalSearchProvider) buildPostings() {
+	p.postings = make(map[string][]posting)
+	p.lengths = make(map[passageRef]int)
+	total := 0
+	for path, doc := range p.index.Documents {
+		for i, passage := range doc.Passages {
+			ref := passageRef{path: path, index: i}
+			p.lengths[ref] = passage.Length
+			total += passage.Length
+			for term, tf := range passage.Terms {
+				p.postings[term] = append(p.postings[term], posting{ref: ref, tf: tf})
+			}
+		}
+	}
+	p.avgLength = 0
+	if len(p.lengths) > 0 {
+		p.avgLength = float64(total) / float64(len(p.lengths))
+	}
+}
+
+func (p *LocalSearchProvider) Search(ctx context.Context, req SearchRequest) (*SearchResponse, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if time.Since(p.lastSynced) >= p.RefreshInterval {
+		if err := p.sync(); err != nil {
+			return nil, err
+		}
+	}
+
+	scores := make(map[passageRef]float64)
+	n := float64(len(p.lengths))
+	for _, term := range uniqueTerms(tokenize(req.Query)) {
+		postings := p.postings[term]
+		if len(postings) == 0 {
+			continue
+		}
+		df := float64(len(postings))
+		idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+		for _, post := range postings {
+			tf := float64(post.tf)
+			norm := 1 - bm25B + bm25B*float64(p.lengths[post.ref])/p.avgLength
+			scores[post.ref] += idf * tf * (bm25K1 + 1) / (tf + bm25K1*norm)
+		}
+	}
+
+	refs := make([]passageRef, 0, len(scores))
+	for ref := range scores {
+		refs = append(refs, ref)
+	}
+	sort.Slice(refs, func(i, j int) bool {
+		if scores[refs[i]] != scores[refs[j]] {
+			return scores[refs[i]] > scores[refs[j]]
+		}
+		if refs[i].path != refs[j].path {
+			return refs[i].path < refs[j].path
+		}
+		return refs[i].index < refs[j].index
+	})
+
+	response := &SearchResponse{}
+	for _, ref := range refs[:min(len(refs), maxResults(req.MaxResults))] {
+		doc := p.index.Documents[ref.path]
+		response.Results = append(response.Results, SearchResult{
+			URL:           ref.path,
+			Title:         doc.Title,
+			Snippet:       doc.Passages[ref.index].Text,
+			PublishedDate: doc.ModTime,
+		})
+	}
+	return response, nil
+}
+
+func parseCorpusDocument(path string, data []byte, info fs.FileInfo) *corpusDocument {
+	doc := &corpusDocument{ModTime: info.ModTime(), Size: info.Size()}
+
+	var paragraphs []string
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".html", ".htm":
+		doc.Title = htmlTitle(string(data))
+		paragraphs = strings.Split(htmlText(string(data)), "\n")
+	case ".md", ".markdown":
+		doc.Title, paragraphs = markdownParagraphs(string(data))
+	default:
+		paragraphs = splitParagraphs(string(data))
+	}
+	if doc.Title == "" {
+		doc.Title = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+
+	for _, text := range packPassages(paragraphs) {
+		terms := tokenize(text)
+		if len(terms) == 0 {
+			continue
+		}
+		frequencies := make(map[string]int)
+		for _, term := range terms {
+			frequencies[term]++
+		}
+		doc.Passages = append(doc.Passages, corpusPassage{Text: text, Terms: frequencies, Length: len(terms)})
+	}
+	return doc
+}
+
+func splitParagraphs(text string) []string {
+	var paragraphs []string
+	for _, block := range blankLine.Split(text, -1) {
+		if block = strings.Join(strings.Fields(block), " "); block != "" {
+			paragraphs = append(paragraphs, block)
+		}
+	}
+	return paragraphs
+}
+
+var (
+	blankLine        = regexp.MustCompile(`\n\s*\n`)
+	markdownImage    = regexp.MustCompile(`!\[([^\]]*)\]\([^)]*\)`)
+	markdownLink     = regexp.MustCompile(`\[([^\]]*)\]\([^)]*\)`)
+	markdownEmphasis = regexp.MustCompile("[*_`~]+")
+	markdownPrefix   = regexp.MustCompile(`(?m)^\s*(#{1,6}|>|[-*+]|\d+\.)\s+`)
+)
+
+// markdownParagraphs strips Markdown syntax and returns the first heading as
+// the title along with the paragraphs.
+func markdownParagraphs(text string) (string, []string) {
+	title := ""
+	for _, line := range strings.Split(text, "\n") {
+		if strings.HasPrefix(line, "# ") {
+			title = strings.TrimSpace(strings.TrimPrefix(line, "# "))
+			break
+		}
+	}
+	text = markdownImage.ReplaceAllString(text, "$1")
+	text = markdownLink.ReplaceAllString(text, "$1")
+	text = markdownPrefix.ReplaceAllString(text, "")
+	text = markdownEmphasis.ReplaceAllString(text, "")
+	return title, splitParagraphs(text)
+}
+
+func htmlTitle(document string) string {
+	tokenizer := html.NewTokenizer(strings.NewReader(document))
+	inTitle := false
+	for {
+		switch tokenizer.Next() {
+		case html.ErrorToken:
+			return ""
+		case html.StartTagToken:
+			name, _ := tokenizer.TagName()
+			inTitle = string(name) == "title"
+		case html.TextToken:
+			if inTitle {
+				return strings.Join(strings.Fields(string(tokenizer.Text())), " ")
+			}
+		}
+	}
+}
+
+// packPassages joins consecutive paragraphs into passages of up to
+// passageChars characters.
+func packPassages(paragraphs []string) []string {
+	var passages []string
+	var current strings.Builder
+	flush := func() {
+		if current.Len() > 0 {
+			passages = append(passages, current.String())
+			current.Reset()
+		}
+	}
+	for _, paragraph := range paragraphs {
+		paragraph = strings.TrimSpace(paragraph)
+		if paragraph == "" {
+			continue
+		}
+		if current.Len() > 0 && current.Len()+1+len(paragraph) > passageChars {
+			flush()
+		}
+		for len(paragraph) > passageChars {
+			cut := strings.LastIndexByte(paragraph[:passageChars], ' ')
+			if cut <= 0 {
+				// No space to break at: back up to a rune boundary.
+				cut = passageChars
+				for cut > 0 && !utf8.RuneStart(paragraph[cut]) {
+					cut--
+				}
+			}
+			flush()
+			passages = append(passages, strings.TrimSpace(paragraph[:cut]))
+			paragraph = strings.TrimSpace(paragraph[cut:])
+		}
+		if current.Len() > 0 {
+			current.WriteString("\n")
+		}
+		current.WriteString(paragraph)
+	}
+	flush()
+	return passages
+}
+
+// tokenize lowercases text and splits it into letter and digit runs,
+// dropping stop words.
+func tokenize(text string) []string {
+	var terms []string
+	for _, word := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	}) {
+		if !stopWords[word] {
+			terms = append(terms, word)
+		}
+	}
+	return terms
+}
+
+func uniqueTerms(terms []string) []string {
+	seen := make(map[string]bool)
+	var unique []string
+	for _, term := range terms {
+		if !seen[term] {
+			seen[term] = true
+			unique = append(unique, term)
+		}
+	}
+	return unique
+}
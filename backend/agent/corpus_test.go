@@ -0,0 +1,63 @@
+package agent
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestLocalSearchProviderRanksWithBM25(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"eiffel.md":  "# Eiffel Tower\n\nThe Eiffel Tower is a wrought-iron tower in Paris. The tower was finished in 1889.",
+		"louvre.md":  "# Louvre\n\nThe Louvre is the most visited museum in Paris.",
+		"notes.txt":  "Towers and bridges of Europe.",
+		"berlin.htm": "<html><head><title>Berlin</title></head><body><p>Berlin is the capital of Germany.</p></body></html>",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	provider, err := NewLocalSearchProvider(dir, filepath.Join(t.TempDir(), "index.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"eiffel tower", []string{"eiffel.md"}},
+		// Both mention Paris once; the shorter passage ranks first.
+		{"paris", []string{"louvre.md", "eiffel.md"}},
+		{"museum paris", []string{"louvre.md", "eiffel.md"}},
+		{"capital of germany", []string{"berlin.htm"}},
+		{"what is the", nil},
+	}
+	for _, tt := range tests {
+		response, err := provider.Search(context.Background(), SearchRequest{Query: tt.query})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, result := range response.Results {
+			got = append(got, result.URL)
+		}
+		if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("Search(%q) = %v, want %v", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestPackPassagesCutsOnRuneBoundaries(t *testing.T) {
+	paragraph := strings.Repeat("é", passageChars)
+	for _, passage := range packPassages([]string{paragraph}) {
+		if !utf8.ValidString(passage) {
+			t.Fatalf("passage is not valid UTF-8: %q", passage)
+		}
+	}
+}
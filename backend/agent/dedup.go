@@ -0,0 +1,122 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const (
+	QueryEmbedderHashing = "hashing"
+	QueryEmbedderGemini  = "gemini"
+
+	defaultQueryDedupThreshold = 0.9
+)
+
+// NewQueryEmbedder returns the Embedder named by config.QueryEmbedder, or nil
+// when query deduplication is lexical only. The Gemini embedder calls the
+// embeddings API through client, which must be a *GeminiClient.
+func NewQueryEmbedder(config *Configuration, client ContentGenerator) (Embedder, error) {
+	switch config.QueryEmbedder {
+	case "":
+		return nil, nil
+	case QueryEmbedderHashing:
+		return &HashingEmbedder{}, nil
+	case QueryEmbedderGemini:
+		gemini, ok := client.(*GeminiClient)
+		if !ok {
+			return nil, fmt.Errorf("query embedder %s requires a Gemini client", config.QueryEmbedder)
+		}
+		// Vertex AI serves embeddings through :predict, not the Gemini API's
+		// batchEmbedContents.
+		if gemini.Vertex != nil {
+			return nil, fmt.Errorf("query embedder %s is not supported on Vertex AI; use %s", config.QueryEmbedder, QueryEmbedderHashing)
+		}
+		return &GeminiEmbedder{Client: gemini, TaskType: "SEMANTIC_SIMILARITY", MaxRetries: 2}, nil
+	}
+	return nil, fmt.Errorf("unknown query embedder %q", config.QueryEmbedder)
+}
+
+// normalizeQuery reduces a query to its sorted, distinct non-stop-word terms,
+// so "opening date of the Eiffel Tower" and "Eiffel Tower opening date"
+// compare equal.
+func normalizeQuery(query string) string {
+	terms := uniqueTerms(tokenize(query))
+	if len(terms) == 0 {
+		return strings.ToLower(strings.TrimSpace(query))
+	}
+	sort.Strings(terms)
+	return strings.Join(terms, " ")
+}
+
+// dedupQueries drops candidates that repeat a prior query or an earlier
+// candidate. A candidate repeats another when their normalised forms match
+// or, with an embedder, when their cosine similarity reaches
+// QueryDedupThreshold. Each dropped candidate is returned as a SkippedQuery
+// naming its closest match.
+func (n *Nodes) dedupQueries(ctx context.Context, prior []string, candidates []Query) ([]Query, []SkippedQuery, error) {
+	var vectors [][]float64
+	if n.embedder != nil && len(candidates) > 0 {
+		texts := append([]string(nil), prior...)
+		for _, candidate := range candidates {
+			texts = append(texts, candidate.Query)
+		}
+		var err error
+		vectors, err = n.embedder.Embed(ctx, texts)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to embed queries: %w", err)
+		}
+		if len(vectors) != len(texts) {
+			return nil, nil, ErrEmbeddingCount
+		}
+	}
+	threshold := n.config.QueryDedupThreshold
+	if threshold <= 0 {
+		threshold = defaultQueryDedupThreshold
+	}
+
+	seen := make(map[string]string)
+	var seenTexts []string
+	var seenVectors [][]float64
+	remember := func(text string, i int) {
+		if key := normalizeQuery(text); seen[key] == "" {
+			seen[key] = text
+		}
+		seenTexts = append(seenTexts, text)
+		if vectors != nil {
+			seenVectors = append(seenVectors, vectors[i])
+		}
+	}
+	for i, text := range prior {
+		remember(text, i)
+	}
+
+	var kept []Query
+	var skipped []SkippedQuery
+	for i, candidate := range candidates {
+		if match, ok := seen[normalizeQuery(candidate.Query)]; ok {
+			skipped = append(skipped, SkippedQuery{
+				Query:        candidate.Query,
+				Reason:       "duplicate of a previous query",
+				ClosestMatch: match,
+				Similarity:   1,
+			})
+			continue
+		}
+		if vectors != nil {
+			if best, score := MostSimilar(vectors[len(prior)+i], seenVectors); best >= 0 && score >= threshold {
+				skipped = append(skipped, SkippedQuery{
+					Query:        candidate.Query,
+					Reason:       fmt.Sprintf("similar to a previous query (%.2f)", score),
+					ClosestMatch: seenTexts[best],
+					Similarity:   score,
+				})
+				continue
+			}
+		}
+		kept = append(kept, candidate)
+		remember(candidate.Query, len(prior)+i)
+	}
+	return kept, skipped, nil
+}
@@ -0,0 +1,98 @@
+package agent
+
+import (
+	"context"
+	"testing"
+)
+
+// vectorEmbedder returns fixed vectors so tests control query similarity.
+type vectorEmbedder map[string][]float64
+
+func (e vectorEmbedder) Embed(ctx context.Context, texts []string) ([][]float64, error) {
+	vectors := make([][]float64, len(texts))
+	for i, text := range texts {
+		vectors[i] = e[text]
+	}
+	return vectors, nil
+}
+
+func TestNormalizeQuery(t *testing.T) {
+	if a, b := normalizeQuery("opening date of the Eiffel Tower"), normalizeQuery("Eiffel Tower opening date"); a != b {
+		t.Errorf("normalised forms differ: %q vs %q", a, b)
+	}
+	if got := normalizeQuery("  The  "); got != "the" {
+		t.Errorf("all-stop-word query normalised to %q", got)
+	}
+}
+
+func TestDedupQueriesLexical(t *testing.T) {
+	nodes := NewNodesWithClient(NewConfiguration(), &countingGenerator{})
+	kept, skipped, err := nodes.dedupQueries(context.Background(),
+		[]string{"Eiffel Tower opening date"},
+		[]Query{
+			{Query: "opening date of the Eiffel Tower"},
+			{Query: "Eiffel Tower height"},
+			{Query: "height of the Eiffel Tower"},
+		})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(kept) != 1 || kept[0].Query != "Eiffel Tower height" {
+		t.Errorf("kept = %v", kept)
+	}
+	want := []SkippedQuery{
+		{Query: "opening date of the Eiffel Tower", Reason: "duplicate of a previous query", ClosestMatch: "Eiffel Tower opening date", Similarity: 1},
+		{Query: "height of the Eiffel Tower", Reason: "duplicate of a previous query", ClosestMatch: "Eiffel Tower height", Similarity: 1},
+	}
+	if len(skipped) != len(want) {
+		t.Fatalf("skipped = %+v, want %+v", skipped, want)
+	}
+	for i := range want {
+		if skipped[i] != want[i] {
+			t.Errorf("skipped[%d] = %+v, want %+v", i, skipped[i], want[i])
+		}
+	}
+}
+
+func TestDedupQueriesEmbeddingThreshold(t *testing.T) {
+	// "solar output" has cosine similarity 0.6 with "solar yield"; "wind farms"
+	// is orthogonal to both.
+	embedder := vectorEmbedder{
+		"solar yield":  {1, 0, 0},
+		"solar output": {3, 4, 0},
+		"wind farms":   {0, 0, 1},
+	}
+	tests := []struct {
+		threshold float64
+		wantKept  int
+	}{
+		{0.59, 1},
+		{0.6, 1},
+		{0.61, 2},
+	}
+	for _, tt := range tests {
+		config := NewConfiguration()
+		config.QueryDedupThreshold = tt.threshold
+		nodes := NewNodesWithClient(config, &countingGenerator{})
+		nodes.SetEmbedder(embedder)
+
+		kept, skipped, err := nodes.dedupQueries(context.Background(),
+			[]string{"solar yield"},
+			[]Query{{Query: "solar output"}, {Query: "wind farms"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(kept) != tt.wantKept {
+			t.Errorf("threshold %v: kept %v, want %d queries", tt.threshold, kept, tt.wantKept)
+			continue
+		}
+		if tt.wantKept == 1 {
+			if len(skipped) != 1 || skipped[0].ClosestMatch != "solar yield" || skipped[0].Similarity != 0.6 ||
+				skipped[0].Reason != "similar to a previous query (0.60)" {
+				t.Errorf("threshold %v: skipped = %+v", tt.threshold, skipped)
+			}
+		} else if len(skipped) != 0 {
+			t.Errorf("threshold %v: skipped = %+v, want none", tt.threshold, skipped)
+		}
+	}
+}
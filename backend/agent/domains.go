@@ -0,0 +1,253 @@
+package agent
+
+import (
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+)
+
+const (
+	SourceAllowed        = "allowed"
+	SourceDenied         = "denied"
+	SourceNotAllowlisted = "not_allowlisted"
+	SourceLowCredibility = "low_credibility"
+
+	groundingRedirectHost = "vertexaisearch.cloud.google.com"
+)
+
+// DomainPolicy decides which sources research may use. Patterns are domain
+// names, which also match their subdomains, or globs such as "*.gov" and
+// "news.*". Deny wins over Allow; when Allow is set, other domains are
+// dropped. Weights rank the remaining sources by credibility (default 1),
+// using the most specific matching pattern, and sources weighted below
+// MinWeight are dropped.
+type DomainPolicy struct {
+	Allow     []string
+	Deny      []string
+	Weights   map[string]float64
+	MinWeight float64
+}
+
+// SourceDecision records what a DomainPolicy did with one search result.
+type SourceDecision struct {
+	Query  string  `json:"query"`
+	URL    string  `json:"url"`
+	Domain string  `json:"domain"`
+	Action string  `json:"action"`
+	Rule   string  `json:"rule,omitempty"`
+	Weight float64 `json:"weight"`
+}
+
+func (d SourceDecision) Kept() bool {
+	return d.Action == SourceAllowed
+}
+
+// domainPolicy returns the configured policy, or nil when no domain rules
+// are set.
+func (c *Configuration) domainPolicy() *DomainPolicy {
+	if len(c.AllowedDomains) == 0 && len(c.DeniedDomains) == 0 && len(c.DomainWeights) == 0 {
+		return nil
+	}
+	return &DomainPolicy{Allow: c.AllowedDomains, Deny: c.DeniedDomains, Weights: c.DomainWeights, MinWeight: c.MinDomainWeight}
+}
+
+// Evaluate decides on one result. Local corpus files have no domain and are
+// always allowed; web results whose domain is unknown are only allowed when
+// there is no allowlist.
+func (p *DomainPolicy) Evaluate(result SearchResult) SourceDecision {
+	domain := sourceDomain(result)
+	decision := SourceDecision{URL: result.URL, Domain: domain, Action: SourceAllowed, Weight: 1}
+	if domain == "" {
+		if len(p.Allow) > 0 && (strings.HasPrefix(result.URL, "http://") || strings.HasPrefix(result.URL, "https://")) {
+			decision.Action, decision.Weight = SourceNotAllowlisted, 0
+		}
+		return decision
+	}
+	if rule := matchDomain(p.Deny, domain); rule != "" {
+		decision.Action, decision.Rule, decision.Weight = SourceDenied, rule, 0
+		return decision
+	}
+	if len(p.Allow) > 0 {
+		rule := matchDomain(p.Allow, domain)
+		if rule == "" {
+			decision.Action, decision.Weight = SourceNotAllowlisted, 0
+			return decision
+		}
+		decision.Rule = rule
+	}
+	patterns := make([]string, 0, len(p.Weights))
+	for pattern := range p.Weights {
+		patterns = append(patterns, pattern)
+	}
+	if rule := matchDomain(patterns, domain); rule != "" {
+		decision.Rule, decision.Weight = rule, p.Weights[rule]
+	}
+	if decision.Weight < p.MinWeight {
+		decision.Action = SourceLowCredibility
+	}
+	return decision
+}
+
+// Filter drops the results the policy rejects and orders the rest by
+// credibility, keeping the provider's order among equal weights. It returns
+// a decision for every input result.
+func (p *DomainPolicy) Filter(query string, results []SearchResult) ([]SearchResult, []SourceDecision) {
+	var kept []SearchResult
+	var weights []float64
+	decisions := make([]SourceDecision, 0, len(results))
+	for _, result := range results {
+		decision := p.Evaluate(result)
+		decision.Query = query
+		decisions = append(decisions, decision)
+		if decision.Kept() {
+			kept = append(kept, result)
+			weights = append(weights, decision.Weight)
+		}
+	}
+	order := make([]int, len(kept))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool { return weights[order[i]] > weights[order[j]] })
+	sorted := make([]SearchResult, len(kept))
+	for i, k := range order {
+		sorted[i] = kept[k]
+	}
+	return sorted, decisions
+}
+
+// FilterGrounding drops the grounding chunks the policy rejects from a
+// grounded response. Text segments supported only by rejected chunks are
+// cut from text, and the remaining supports are moved to match, so nothing
+// written from a rejected source survives into the summary.
+func (p *DomainPolicy) FilterGrounding(text string, grounding GroundingMetadata) (string, GroundingMetadata) {
+	filtered := GroundingMetadata{}
+	newIndex := make(map[int]int)
+	for i, chunk := range grounding.GroundingChunks {
+		if p.Evaluate(SearchResult{URL: chunk.Web.URI, Title: chunk.Web.Title}).Kept() {
+			newIndex[i] = len(filtered.GroundingChunks)
+			filtered.GroundingChunks = append(filtered.GroundingChunks, chunk)
+		}
+	}
+
+	type span struct{ start, end int }
+	var cuts []span
+	for _, support := range grounding.GroundingSupports {
+		rejected := len(support.GroundingChunkIndices) > 0
+		for _, index := range support.GroundingChunkIndices {
+			if _, ok := newIndex[index]; ok {
+				rejected = false
+			}
+		}
+		if !rejected {
+			continue
+		}
+		start := runeBoundary(text, support.Segment.StartIndex)
+		end := runeBoundary(text, support.Segment.EndIndex)
+		for end < len(text) && text[end] == ' ' {
+			end++
+		}
+		if end > start {
+			cuts = append(cuts, span{start, end})
+		}
+	}
+	if len(cuts) == 0 && len(newIndex) == len(grounding.GroundingChunks) {
+		return text, grounding
+	}
+	sort.Slice(cuts, func(i, j int) bool { return cuts[i].start < cuts[j].start })
+	var merged []span
+	for _, cut := range cuts {
+		if last := len(merged) - 1; last >= 0 && cut.start <= merged[last].end {
+			merged[last].end = max(merged[last].end, cut.end)
+			continue
+		}
+		merged = append(merged, cut)
+	}
+
+	// shift maps an offset in text to the same position after the cuts.
+	shift := func(offset int) int {
+		removed := 0
+		for _, cut := range merged {
+			if offset <= cut.start {
+				break
+			}
+			if offset < cut.end {
+				return cut.start - removed
+			}
+			removed += cut.end - cut.start
+		}
+		return offset - removed
+	}
+
+	var sb strings.Builder
+	position := 0
+	for _, cut := range merged {
+		sb.WriteString(text[position:cut.start])
+		position = cut.end
+	}
+	sb.WriteString(text[position:])
+
+	for _, support := range grounding.GroundingSupports {
+		var indices []int
+		for _, index := range support.GroundingChunkIndices {
+			if kept, ok := newIndex[index]; ok {
+				indices = append(indices, kept)
+			}
+		}
+		if len(indices) == 0 {
+			continue
+		}
+		moved := GroundingSupport{GroundingChunkIndices: indices}
+		moved.Segment.StartIndex = shift(support.Segment.StartIndex)
+		moved.Segment.EndIndex = shift(support.Segment.EndIndex)
+		if moved.Segment.EndIndex > moved.Segment.StartIndex {
+			filtered.GroundingSupports = append(filtered.GroundingSupports, moved)
+		}
+	}
+	return strings.TrimSpace(sb.String()), filtered
+}
+
+// matchDomain returns the most specific pattern matching domain, or "" if
+// none does.
+func matchDomain(patterns []string, domain string) string {
+	best := ""
+	for _, pattern := range patterns {
+		pattern = strings.ToLower(strings.TrimSpace(pattern))
+		var matched bool
+		if strings.Contains(pattern, "*") {
+			matched, _ = path.Match(pattern, domain)
+		} else {
+			matched = domain == pattern || strings.HasSuffix(domain, "."+pattern)
+		}
+		if matched && specificity(pattern) > specificity(best) {
+			best = pattern
+		}
+	}
+	return best
+}
+
+func specificity(pattern string) int {
+	if pattern == "" {
+		return -1
+	}
+	return len(strings.ReplaceAll(pattern, "*", ""))
+}
+
+// sourceDomain returns the lowercased host of a result without "www.".
+// Gemini grounding links point at a redirect host, so for those the title,
+// which Gemini sets to the source's domain, is used instead.
+func sourceDomain(result SearchResult) string {
+	parsed, err := url.Parse(result.URL)
+	if err != nil {
+		return ""
+	}
+	host := strings.ToLower(parsed.Hostname())
+	if host == groundingRedirectHost {
+		host = strings.ToLower(strings.TrimSpace(result.Title))
+		if strings.ContainsAny(host, " /") || !strings.Contains(host, ".") {
+			return ""
+		}
+	}
+	return strings.TrimPrefix(host, "www.")
+}
@@ -0,0 +1,148 @@
+package agent
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestMatchDomain(t *testing.T) {
+	patterns := []string{"gov", "*.gov", "nasa.gov", "news.*", "example.com"}
+	tests := []struct {
+		domain string
+		want   string
+	}{
+		{"nasa.gov", "nasa.gov"},
+		{"climate.nasa.gov", "nasa.gov"},
+		{"noaa.gov", "*.gov"},
+		{"news.bbc", "news.*"},
+		{"example.com", "example.com"},
+		{"docs.example.com", "example.com"},
+		{"badexample.com", ""},
+		{"example.org", ""},
+	}
+	for _, tt := range tests {
+		if got := matchDomain(patterns, tt.domain); got != tt.want {
+			t.Errorf("matchDomain(%s) = %q, want %q", tt.domain, got, tt.want)
+		}
+	}
+}
+
+func TestDomainPolicyEvaluate(t *testing.T) {
+	policy := &DomainPolicy{
+		Allow:     []string{"*.gov", "wikipedia.org", "blog.example.com"},
+		Deny:      []string{"spam.gov"},
+		Weights:   map[string]float64{"*.gov": 2, "nasa.gov": 3, "wikipedia.org": 0.5},
+		MinWeight: 1,
+	}
+	tests := []struct {
+		url    string
+		title  string
+		action string
+		rule   string
+		weight float64
+	}{
+		{"https://www.nasa.gov/news", "", SourceAllowed, "nasa.gov", 3},
+		{"https://noaa.gov/", "", SourceAllowed, "*.gov", 2},
+		{"https://blog.example.com/post", "", SourceAllowed, "blog.example.com", 1},
+		{"https://spam.gov/", "", SourceDenied, "spam.gov", 0},
+		{"https://en.wikipedia.org/wiki/Go", "", SourceLowCredibility, "wikipedia.org", 0.5},
+		{"https://example.com/", "", SourceNotAllowlisted, "", 0},
+		{"https://" + groundingRedirectHost + "/grounding-api-redirect/abc", "nasa.gov", SourceAllowed, "nasa.gov", 3},
+		{"https://" + groundingRedirectHost + "/grounding-api-redirect/abc", "Some Page", SourceNotAllowlisted, "", 0},
+		{"notes/solar.md", "solar", SourceAllowed, "", 1},
+	}
+	for _, tt := range tests {
+		got := policy.Evaluate(SearchResult{URL: tt.url, Title: tt.title})
+		if got.Action != tt.action || got.Rule != tt.rule || got.Weight != tt.weight {
+			t.Errorf("Evaluate(%s, %q) = %s %q %v, want %s %q %v", tt.url, tt.title, got.Action, got.Rule, got.Weight, tt.action, tt.rule, tt.weight)
+		}
+	}
+}
+
+func TestDomainPolicyFilterOrdersByWeight(t *testing.T) {
+	policy := &DomainPolicy{
+		Deny:    []string{"tabloid.com"},
+		Weights: map[string]float64{"nature.com": 3, "*.edu": 2},
+	}
+	results := []SearchResult{
+		{URL: "https://blog.one.com/a"},
+		{URL: "https://tabloid.com/b"},
+		{URL: "https://mit.edu/c"},
+		{URL: "https://blog.two.com/d"},
+		{URL: "https://www.nature.com/e"},
+	}
+	kept, decisions := policy.Filter("solar", results)
+
+	var urls []string
+	for _, result := range kept {
+		urls = append(urls, result.URL)
+	}
+	want := []string{"https://www.nature.com/e", "https://mit.edu/c", "https://blog.one.com/a", "https://blog.two.com/d"}
+	if !slices.Equal(urls, want) {
+		t.Errorf("kept %v, want %v", urls, want)
+	}
+	if len(decisions) != len(results) {
+		t.Fatalf("got %d decisions for %d results", len(decisions), len(results))
+	}
+	if d := decisions[1]; d.Action != SourceDenied || d.Query != "solar" || d.Domain != "tabloid.com" {
+		t.Errorf("tabloid decision = %+v", d)
+	}
+}
+
+func TestDomainPolicyFilterGrounding(t *testing.T) {
+	policy := &DomainPolicy{Deny: []string{"tabloid.com"}}
+	text := "Paris has 2 million people. Aliens built it. The Seine crosses it."
+	segment := func(s string) GroundingSupport {
+		var support GroundingSupport
+		support.Segment.StartIndex = strings.Index(text, s)
+		support.Segment.EndIndex = support.Segment.StartIndex + len(s)
+		return support
+	}
+	chunk := func(title string) GroundingChunk {
+		var c GroundingChunk
+		c.Web.URI = "https://" + groundingRedirectHost + "/grounding-api-redirect/" + title
+		c.Web.Title = title
+		return c
+	}
+
+	first, second, third := segment("Paris has 2 million people."), segment("Aliens built it."), segment("The Seine crosses it.")
+	first.GroundingChunkIndices = []int{0}
+	second.GroundingChunkIndices = []int{1}
+	third.GroundingChunkIndices = []int{1, 2}
+	grounding := GroundingMetadata{
+		GroundingChunks:   []GroundingChunk{chunk("insee.fr"), chunk("tabloid.com"), chunk("wikipedia.org")},
+		GroundingSupports: []GroundingSupport{first, second, third},
+	}
+
+	gotText, got := policy.FilterGrounding(text, grounding)
+	if want := "Paris has 2 million people. The Seine crosses it."; gotText != want {
+		t.Fatalf("text = %q, want %q", gotText, want)
+	}
+	if len(got.GroundingChunks) != 2 || got.GroundingChunks[0].Web.Title != "insee.fr" || got.GroundingChunks[1].Web.Title != "wikipedia.org" {
+		t.Errorf("chunks = %+v", got.GroundingChunks)
+	}
+	if len(got.GroundingSupports) != 2 {
+		t.Fatalf("supports = %+v", got.GroundingSupports)
+	}
+	for i, want := range []struct {
+		text    string
+		indices []int
+	}{
+		{"Paris has 2 million people.", []int{0}},
+		{"The Seine crosses it.", []int{1}},
+	} {
+		support := got.GroundingSupports[i]
+		if s := gotText[support.Segment.StartIndex:support.Segment.EndIndex]; s != want.text {
+			t.Errorf("support %d covers %q, want %q", i, s, want.text)
+		}
+		if !slices.Equal(support.GroundingChunkIndices, want.indices) {
+			t.Errorf("support %d indices = %v, want %v", i, support.GroundingChunkIndices, want.indices)
+		}
+	}
+
+	// Nothing rejected leaves the response untouched.
+	if gotText, _ := (&DomainPolicy{Deny: []string{"example.org"}}).FilterGrounding(text, grounding); gotText != text {
+		t.Errorf("unfiltered text changed to %q", gotText)
+	}
+}
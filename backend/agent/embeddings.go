@@ -0,0 +1,231 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"strings"
+	"unicode"
+)
+
+const (
+	DefaultEmbeddingModel = "gemini-embedding-001"
+
+	// maxEmbedBatch is the most texts batchEmbedContents accepts per call.
+	maxEmbedBatch = 100
+
+	defaultHashingDimensions = 256
+)
+
+// Embedder turns texts into vectors. The result has one vector per input
+// text, in order.
+type Embedder interface {
+	Embed(ctx context.Context, texts []string) ([][]float64, error)
+}
+
+// GeminiEmbedder calls embedContent for a single text and batchEmbedContents
+// for several. TaskType (e.g. "SEMANTIC_SIMILARITY") and Dimensions are
+// optional.
+type GeminiEmbedder struct {
+	Client     *GeminiClient
+	Model      string
+	TaskType   string
+	Dimensions int
+	MaxRetries int
+}
+
+type embedContentRequest struct {
+	Model                string  `json:"model,omitempty"`
+	Content              Content `json:"content"`
+	TaskType             string  `json:"taskType,omitempty"`
+	OutputDimensionality int     `json:"outputDimensionality,omitempty"`
+}
+
+type contentEmbedding struct {
+	Values []float64 `json:"values"`
+}
+
+type embedContentResponse struct {
+	Embedding contentEmbedding `json:"embedding"`
+}
+
+type batchEmbedContentsRequest struct {
+	Requests []embedContentRequest `json:"requests"`
+}
+
+type batchEmbedContentsResponse struct {
+	Embeddings []contentEmbedding `json:"embeddings"`
+}
+
+func (e *GeminiEmbedder) Embed(ctx context.Context, texts []string) ([][]float64, error) {
+	if len(texts) == 0 {
+		return nil, nil
+	}
+	client := e.Client
+	if client == nil {
+		client = &GeminiClient{}
+	}
+	model := e.model()
+	policy := RetryPolicy{MaxRetries: e.MaxRetries}
+
+	if len(texts) == 1 {
+		response, err := retry(ctx, policy, func() (*embedContentResponse, error) {
+			var response embedContentResponse
+			err := client.post(ctx, model, "embedContent", e.request("", texts[0]), &response)
+			return &response, err
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to embed content: %w", err)
+		}
+		return [][]float64{response.Embedding.Values}, nil
+	}
+
+	vectors := make([][]float64, 0, len(texts))
+	for start := 0; start < len(texts); start += maxEmbedBatch {
+		batch := texts[start:min(start+maxEmbedBatch, len(texts))]
+		req := batchEmbedContentsRequest{}
+		for _, text := range batch {
+			req.Requests = append(req.Requests, e.request("models/"+strings.TrimPrefix(model, "models/"), text))
+		}
+
+		response, err := retry(ctx, policy, func() (*batchEmbedContentsResponse, error) {
+			var response batchEmbedContentsResponse
+			err := client.post(ctx, model, "batchEmbedContents", req, &response)
+			return &response, err
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to batch embed contents: %w", err)
+		}
+		if len(response.Embeddings) != len(batch) {
+			return nil, fmt.Errorf("%w: got %d for %d texts", ErrEmbeddingCount, len(response.Embeddings), len(batch))
+		}
+		for _, embedding := range response.Embeddings {
+			vectors = append(vectors, embedding.Values)
+		}
+	}
+	return vectors, nil
+}
+
+func (e *GeminiEmbedder) model() string {
+	if e.Model == "" {
+		return DefaultEmbeddingModel
+	}
+	return e.Model
+}
+
+func (e *GeminiEmbedder) request(model, text string) embedContentRequest {
+	return embedContentRequest{
+		Model:                model,
+		Content:              Content{Parts: []Part{{Text: text}}},
+		TaskType:             e.TaskType,
+		OutputDimensionality: e.Dimensions,
+	}
+}
+
+// HashingEmbedder is a deterministic, offline Embedder for tests. It hashes
+// lowercased words and adjacent word pairs into a fixed number of signed
+// buckets, so texts sharing vocabulary get similar vectors.
+type HashingEmbedder struct {
+	Dimensions int
+}
+
+func (e *HashingEmbedder) Embed(ctx context.Context, texts []string) ([][]float64, error) {
+	dimensions := e.Dimensions
+	if dimensions <= 0 {
+		dimensions = defaultHashingDimensions
+	}
+	vectors := make([][]float64, len(texts))
+	for i, text := range texts {
+		vector := make([]float64, dimensions)
+		words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+		})
+		for j, word := range words {
+			addHashedFeature(vector, word)
+			if j > 0 {
+				addHashedFeature(vector, words[j-1]+" "+word)
+			}
+		}
+		vectors[i] = Normalize(vector)
+	}
+	return vectors, nil
+}
+
+func addHashedFeature(vector []float64, feature string) {
+	h := fnv.New64a()
+	h.Write([]byte(feature))
+	sum := h.Sum64()
+	sign := 1.0
+	if sum&(1<<63) != 0 {
+		sign = -1
+	}
+	vector[sum%uint64(len(vector))] += sign
+}
+
+// CosineSimilarity returns the cosine of the angle between a and b, or 0 if
+// either is a zero vector or their lengths differ.
+func CosineSimilarity(a, b []float64) float64 {
+	if len(a) != len(b) {
+		return 0
+	}
+	var dot, normA, normB float64
+	for i := range a {
+		dot += a[i] * b[i]
+		normA += a[i] * a[i]
+		normB += b[i] * b[i]
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
+
+// Normalize scales v to unit length in place and returns it. Zero vectors
+// are returned unchanged.
+func Normalize(v []float64) []float64 {
+	var norm float64
+	for _, x := range v {
+		norm += x * x
+	}
+	if norm == 0 {
+		return v
+	}
+	norm = math.Sqrt(norm)
+	for i := range v {
+		v[i] /= norm
+	}
+	return v
+}
+
+// MostSimilar returns the index of the candidate closest to query and its
+// cosine similarity, or -1 when there are no candidates.
+func MostSimilar(query []float64, candidates [][]float64) (int, float64) {
+	best, bestScore := -1, math.Inf(-1)
+	for i, candidate := range candidates {
+		if score := CosineSimilarity(query, candidate); score > bestScore {
+			best, bestScore = i, score
+		}
+	}
+	if best < 0 {
+		return -1, 0
+	}
+	return best, bestScore
+}
+
+// ErrEmbeddingCount is returned when an Embedder produces a different number
+// of vectors than it was given texts.
+var ErrEmbeddingCount = errors.New("embedder returned the wrong number of vectors")
+
+// EmbedOne embeds a single text.
+func EmbedOne(ctx context.Context, embedder Embedder, text string) ([]float64, error) {
+	vectors, err := embedder.Embed(ctx, []string{text})
+	if err != nil {
+		return nil, err
+	}
+	if len(vectors) != 1 {
+		return nil, ErrEmbeddingCount
+	}
+	return vectors[0], nil
+}
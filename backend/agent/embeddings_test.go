@@ -0,0 +1,174 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestCosineSimilarity(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b []float64
+		want float64
+	}{
+		{"identical", []float64{1, 2, 3}, []float64{1, 2, 3}, 1},
+		{"scaled", []float64{1, 2}, []float64{2, 4}, 1},
+		{"orthogonal", []float64{1, 0}, []float64{0, 1}, 0},
+		{"opposite", []float64{1, -1}, []float64{-1, 1}, -1},
+		{"zero vector", []float64{0, 0}, []float64{1, 1}, 0},
+		{"length mismatch", []float64{1, 2, 3}, []float64{1, 2}, 0},
+		{"empty", nil, nil, 0},
+	}
+	for _, tt := range tests {
+		if got := CosineSimilarity(tt.a, tt.b); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("%s: CosineSimilarity = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestHashingEmbedder(t *testing.T) {
+	embedder := &HashingEmbedder{}
+	texts := []string{"solar panel efficiency", "Solar panel efficiency!", "medieval castle architecture", ""}
+	first, err := embedder.Embed(context.Background(), texts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := embedder.Embed(context.Background(), texts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, vector := range first {
+		if len(vector) != defaultHashingDimensions {
+			t.Fatalf("vector %d has %d dimensions, want %d", i, len(vector), defaultHashingDimensions)
+		}
+		for j := range vector {
+			if vector[j] != second[i][j] {
+				t.Fatalf("vector %d differs between calls", i)
+			}
+		}
+		var norm float64
+		for _, x := range vector {
+			norm += x * x
+		}
+		want := 1.0
+		if texts[i] == "" {
+			want = 0
+		}
+		if math.Abs(norm-want) > 1e-9 {
+			t.Errorf("vector %d has squared norm %v, want %v", i, norm, want)
+		}
+	}
+
+	if sim := CosineSimilarity(first[0], first[1]); math.Abs(sim-1) > 1e-9 {
+		t.Errorf("case and punctuation changed the vector: similarity %v", sim)
+	}
+	if related, unrelated := CosineSimilarity(first[0], first[1]), CosineSimilarity(first[0], first[2]); unrelated >= related {
+		t.Errorf("unrelated text scored %v, related %v", unrelated, related)
+	}
+}
+
+// embedServer answers embedContent and batchEmbedContents with one-value
+// vectors holding the number in each "text-N" input. drop removes that many
+// embeddings from every batch response.
+func embedServer(t *testing.T, drop int) (*httptest.Server, *[]int) {
+	t.Helper()
+	var batches []int
+	value := func(text string) []float64 {
+		n, err := strconv.Atoi(strings.TrimPrefix(text, "text-"))
+		if err != nil {
+			t.Errorf("unexpected text %q", text)
+		}
+		return []float64{float64(n)}
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/models/gemini-embedding-001:embedContent"):
+			var req embedContentRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				t.Error(err)
+			}
+			json.NewEncoder(w).Encode(embedContentResponse{Embedding: contentEmbedding{Values: value(req.Content.Parts[0].Text)}})
+		case strings.HasSuffix(r.URL.Path, "/models/gemini-embedding-001:batchEmbedContents"):
+			var req batchEmbedContentsRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				t.Error(err)
+			}
+			batches = append(batches, len(req.Requests))
+			var response batchEmbedContentsResponse
+			for _, sub := range req.Requests[:len(req.Requests)-drop] {
+				if sub.Model != "models/gemini-embedding-001" || sub.TaskType != "SEMANTIC_SIMILARITY" {
+					t.Errorf("sub-request model %q, task type %q", sub.Model, sub.TaskType)
+				}
+				response.Embeddings = append(response.Embeddings, contentEmbedding{Values: value(sub.Content.Parts[0].Text)})
+			}
+			json.NewEncoder(w).Encode(response)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server, &batches
+}
+
+func embedTexts(n int) []string {
+	texts := make([]string, n)
+	for i := range texts {
+		texts[i] = fmt.Sprintf("text-%d", i)
+	}
+	return texts
+}
+
+func TestGeminiEmbedderBatches(t *testing.T) {
+	server, batches := embedServer(t, 0)
+	embedder := &GeminiEmbedder{
+		Client:   &GeminiClient{APIKey: "test", BaseURL: server.URL, HTTPClient: server.Client()},
+		TaskType: "SEMANTIC_SIMILARITY",
+	}
+
+	vectors, err := embedder.Embed(context.Background(), embedTexts(250))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprint(*batches); got != "[100 100 50]" {
+		t.Errorf("batch sizes = %s, want [100 100 50]", got)
+	}
+	if len(vectors) != 250 {
+		t.Fatalf("got %d vectors, want 250", len(vectors))
+	}
+	for i, vector := range vectors {
+		if vector[0] != float64(i) {
+			t.Fatalf("vector %d = %v, out of order", i, vector)
+		}
+	}
+
+	vector, err := EmbedOne(context.Background(), embedder, "text-7")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(vector) != 1 || vector[0] != 7 {
+		t.Errorf("EmbedOne = %v, want [7]", vector)
+	}
+	if len(*batches) != 3 {
+		t.Error("a single text went through batchEmbedContents")
+	}
+}
+
+func TestGeminiEmbedderCountMismatch(t *testing.T) {
+	server, _ := embedServer(t, 1)
+	embedder := &GeminiEmbedder{
+		Client:   &GeminiClient{APIKey: "test", BaseURL: server.URL, HTTPClient: server.Client()},
+		TaskType: "SEMANTIC_SIMILARITY",
+	}
+	if _, err := embedder.Embed(context.Background(), embedTexts(3)); !errors.Is(err, ErrEmbeddingCount) {
+		t.Errorf("Embed error = %v, want ErrEmbeddingCount", err)
+	}
+}
@@ -0,0 +1,133 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// APIError is a non-2xx response returned by the Gemini API.
+type APIError struct {
+	StatusCode int
+	Status     string
+	Message    string
+	RetryAfter time.Duration
+	QuotaIDs   []string
+}
+
+func (e *APIError) Error() string {
+	if e.Status != "" {
+		return fmt.Sprintf("gemini api error %d (%s): %s", e.StatusCode, e.Status, e.Message)
+	}
+	return fmt.Sprintf("gemini api error %d: %s", e.StatusCode, e.Message)
+}
+
+// ErrRateLimited is returned for transient 429 responses. It is retried.
+type ErrRateLimited struct{ *APIError }
+
+func (e *ErrRateLimited) Unwrap() error { return e.APIError }
+
+// ErrQuotaExceeded is returned when a daily or billing quota is exhausted.
+// Retrying will not help until the quota resets, so it is never retried.
+type ErrQuotaExceeded struct{ *APIError }
+
+func (e *ErrQuotaExceeded) Unwrap() error { return e.APIError }
+
+// ErrContextTooLong is returned when the prompt exceeds the model's input
+// token limit.
+type ErrContextTooLong struct{ *APIError }
+
+func (e *ErrContextTooLong) Unwrap() error { return e.APIError }
+
+// ErrSafetyBlocked is returned when Gemini produces no usable answer for
+// policy reasons. BlockReason is set when the prompt itself was blocked;
+// FinishReason is set when generation stopped on a blocked candidate.
+type ErrSafetyBlocked struct {
+	BlockReason   string
+	FinishReason  string
+	SafetyRatings []SafetyRating
+}
+
+func (e *ErrSafetyBlocked) Error() string {
+	if e.BlockReason != "" {
+		return fmt.Sprintf("prompt blocked by gemini: %s", e.BlockReason)
+	}
+	return fmt.Sprintf("response blocked by gemini: finish reason %s", e.FinishReason)
+}
+
+type apiErrorBody struct {
+	Error struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+		Status  string `json:"status"`
+		Details []struct {
+			Type       string `json:"@type"`
+			RetryDelay string `json:"retryDelay"`
+			Violations []struct {
+				QuotaID string `json:"quotaId"`
+			} `json:"violations"`
+		} `json:"details"`
+	} `json:"error"`
+}
+
+// NewAPIError builds the typed error for a failed response from its status
+// code, headers and JSON error body.
+func NewAPIError(statusCode int, header http.Header, body []byte) error {
+	apiErr := &APIError{StatusCode: statusCode}
+
+	var parsed apiErrorBody
+	if err := json.Unmarshal(body, &parsed); err == nil && parsed.Error.Message != "" {
+		apiErr.Status = parsed.Error.Status
+		apiErr.Message = parsed.Error.Message
+		for _, detail := range parsed.Error.Details {
+			if strings.HasSuffix(detail.Type, "google.rpc.RetryInfo") {
+				if d, err := time.ParseDuration(detail.RetryDelay); err == nil {
+					apiErr.RetryAfter = d
+				}
+			}
+			for _, v := range detail.Violations {
+				apiErr.QuotaIDs = append(apiErr.QuotaIDs, v.QuotaID)
+			}
+		}
+	} else {
+		apiErr.Message = strings.TrimSpace(string(body))
+	}
+
+	if d, ok := parseRetryAfter(header.Get("Retry-After")); ok {
+		apiErr.RetryAfter = d
+	}
+
+	switch {
+	case statusCode == http.StatusTooManyRequests:
+		for _, id := range apiErr.QuotaIDs {
+			if strings.Contains(id, "PerDay") {
+				return &ErrQuotaExceeded{apiErr}
+			}
+		}
+		return &ErrRateLimited{apiErr}
+	case statusCode == http.StatusBadRequest && strings.Contains(apiErr.Message, "exceeds the maximum number of tokens"):
+		return &ErrContextTooLong{apiErr}
+	}
+	return apiErr
+}
+
+// parseRetryAfter accepts both forms of the Retry-After header: a number of
+// seconds or an HTTP date.
+func parseRetryAfter(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(value); err == nil && secs >= 0 {
+		return time.Duration(secs) * time.Second, true
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
@@ -0,0 +1,156 @@
+package agent
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"testing"
+	"time"
+)
+
+const quotaErrorBody = `{"error": {"code": 429, "message": "Quota exceeded", "status": "RESOURCE_EXHAUSTED", "details": [
+	{"@type": "type.googleapis.com/google.rpc.QuotaFailure", "violations": [{"quotaId": "GenerateRequestsPerDayPerProjectPerModel-FreeTier"}]},
+	{"@type": "type.googleapis.com/google.rpc.RetryInfo", "retryDelay": "17s"}
+]}}`
+
+func TestNewAPIError(t *testing.T) {
+	tests := []struct {
+		name       string
+		status     int
+		header     http.Header
+		body       string
+		wantType   string
+		wantStatus string
+		wantMsg    string
+		wantRetry  time.Duration
+		wantQuota  []string
+	}{
+		{
+			name:       "daily quota",
+			status:     http.StatusTooManyRequests,
+			body:       quotaErrorBody,
+			wantType:   "quota",
+			wantStatus: "RESOURCE_EXHAUSTED",
+			wantMsg:    "Quota exceeded",
+			wantRetry:  17 * time.Second,
+			wantQuota:  []string{"GenerateRequestsPerDayPerProjectPerModel-FreeTier"},
+		},
+		{
+			name:       "per minute rate limit",
+			status:     http.StatusTooManyRequests,
+			body:       `{"error": {"code": 429, "message": "Resource exhausted", "status": "RESOURCE_EXHAUSTED", "details": [{"@type": "type.googleapis.com/google.rpc.QuotaFailure", "violations": [{"quotaId": "GenerateRequestsPerMinutePerProjectPerModel"}]}]}}`,
+			wantType:   "rate",
+			wantStatus: "RESOURCE_EXHAUSTED",
+			wantMsg:    "Resource exhausted",
+			wantQuota:  []string{"GenerateRequestsPerMinutePerProjectPerModel"},
+		},
+		{
+			name:      "plain 429 with Retry-After seconds",
+			status:    http.StatusTooManyRequests,
+			header:    http.Header{"Retry-After": {"30"}},
+			body:      "slow down\n",
+			wantType:  "rate",
+			wantMsg:   "slow down",
+			wantRetry: 30 * time.Second,
+		},
+		{
+			name:       "Retry-After header overrides retryDelay",
+			status:     http.StatusTooManyRequests,
+			header:     http.Header{"Retry-After": {"5"}},
+			body:       quotaErrorBody,
+			wantType:   "quota",
+			wantStatus: "RESOURCE_EXHAUSTED",
+			wantMsg:    "Quota exceeded",
+			wantRetry:  5 * time.Second,
+			wantQuota:  []string{"GenerateRequestsPerDayPerProjectPerModel-FreeTier"},
+		},
+		{
+			name:       "context too long",
+			status:     http.StatusBadRequest,
+			body:       `{"error": {"code": 400, "message": "The input token count (1200000) exceeds the maximum number of tokens allowed (1048576).", "status": "INVALID_ARGUMENT"}}`,
+			wantType:   "context",
+			wantStatus: "INVALID_ARGUMENT",
+			wantMsg:    "The input token count (1200000) exceeds the maximum number of tokens allowed (1048576).",
+		},
+		{
+			name:       "other bad request",
+			status:     http.StatusBadRequest,
+			body:       `{"error": {"code": 400, "message": "API key not valid.", "status": "INVALID_ARGUMENT"}}`,
+			wantType:   "api",
+			wantStatus: "INVALID_ARGUMENT",
+			wantMsg:    "API key not valid.",
+		},
+		{
+			name:     "server error",
+			status:   http.StatusServiceUnavailable,
+			body:     "upstream unavailable",
+			wantType: "api",
+			wantMsg:  "upstream unavailable",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := tt.header
+			if header == nil {
+				header = http.Header{}
+			}
+			err := NewAPIError(tt.status, header, []byte(tt.body))
+
+			var rateLimited *ErrRateLimited
+			var quotaExceeded *ErrQuotaExceeded
+			var contextTooLong *ErrContextTooLong
+			gotType := "api"
+			switch {
+			case errors.As(err, &rateLimited):
+				gotType = "rate"
+			case errors.As(err, &quotaExceeded):
+				gotType = "quota"
+			case errors.As(err, &contextTooLong):
+				gotType = "context"
+			}
+			if gotType != tt.wantType {
+				t.Errorf("error type = %s, want %s (%T)", gotType, tt.wantType, err)
+			}
+
+			var apiErr *APIError
+			if !errors.As(err, &apiErr) {
+				t.Fatalf("errors.As(%T, *APIError) failed", err)
+			}
+			if apiErr.StatusCode != tt.status || apiErr.Status != tt.wantStatus || apiErr.Message != tt.wantMsg {
+				t.Errorf("got %d %q %q, want %d %q %q", apiErr.StatusCode, apiErr.Status, apiErr.Message, tt.status, tt.wantStatus, tt.wantMsg)
+			}
+			if apiErr.RetryAfter != tt.wantRetry {
+				t.Errorf("RetryAfter = %v, want %v", apiErr.RetryAfter, tt.wantRetry)
+			}
+			if !slices.Equal(apiErr.QuotaIDs, tt.wantQuota) {
+				t.Errorf("QuotaIDs = %v, want %v", apiErr.QuotaIDs, tt.wantQuota)
+			}
+		})
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	future := time.Now().Add(90 * time.Second).UTC().Format(http.TimeFormat)
+	past := time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat)
+
+	tests := []struct {
+		value  string
+		wantOK bool
+		min    time.Duration
+		max    time.Duration
+	}{
+		{"", false, 0, 0},
+		{"12", true, 12 * time.Second, 12 * time.Second},
+		{"0", true, 0, 0},
+		{"-1", false, 0, 0},
+		{future, true, 80 * time.Second, 90 * time.Second},
+		{past, true, 0, 0},
+		{"soon", false, 0, 0},
+	}
+	for _, tt := range tests {
+		got, ok := parseRetryAfter(tt.value)
+		if ok != tt.wantOK || got < tt.min || got > tt.max {
+			t.Errorf("parseRetryAfter(%q) = %v, %v; want %v in [%v, %v]", tt.value, got, ok, tt.wantOK, tt.min, tt.max)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package agent
+
+import "context"
+
+type EventType string
+
+const (
+	EventNodeStart EventType = "node_start"
+	EventNodeEnd   EventType = "node_end"
+	// EventThought carries a thought summary from a thinking model. It is
+	// separate from the answer text so the UI can show it as a thinking step.
+	EventThought EventType = "thought"
+)
+
+// Event is one step of a running workflow, delivered to the EventHandler in
+// the context.
+type Event struct {
+	Type  EventType `json:"type"`
+	Node  string    `json:"node,omitempty"`
+	Model string    `json:"model,omitempty"`
+	Text  string    `json:"text,omitempty"`
+}
+
+// EventHandler receives workflow events. WebResearchNode searches queries
+// concurrently, so a handler may be called from several goroutines at once.
+type EventHandler func(Event)
+
+type eventHandlerKey struct{}
+
+// WithEventHandler returns a context whose workflow events are passed to
+// handler.
+func WithEventHandler(ctx context.Context, handler EventHandler) context.Context {
+	return context.WithValue(ctx, eventHandlerKey{}, handler)
+}
+
+// emitEvent sends event to the handler in ctx, if any. The node name defaults
+// to the one recorded by WithNodeName.
+func emitEvent(ctx context.Context, event Event) {
+	handler, _ := ctx.Value(eventHandlerKey{}).(EventHandler)
+	if handler == nil {
+		return
+	}
+	if event.Node == "" {
+		event.Node = NodeNameFromContext(ctx)
+	}
+	handler(event)
+}
@@ -0,0 +1,210 @@
+package agent
+
+import (
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// boilerplatePattern matches class and id values of page chrome such as
+// menus, cookie banners and share widgets. Elements that also match
+// contentPattern are kept, since wrappers like "main-content has-sidebar"
+// often hold the article itself.
+var (
+	boilerplatePattern = regexp.MustCompile(`(?i)(^|[\s_-])(nav|navbar|menu|header|footer|sidebar|aside|comments?|cookie|banner|breadcrumbs?|share|social|related|advert|ads|promo|newsletter|subscribe|popup|modal)($|[\s_-])`)
+	contentPattern     = regexp.MustCompile(`(?i)article|content|main|post|entry|story|body`)
+)
+
+// ExtractMainText returns the title and main article text of an HTML
+// document. Navigation, headers, footers, forms and elements whose class or
+// id looks like boilerplate are dropped. The content root is the largest
+// <article> or <main> element, or else the element whose direct paragraphs
+// hold the most non-link text. Paragraphs are separated by newlines.
+func ExtractMainText(document string) (string, string) {
+	root, err := html.Parse(strings.NewReader(document))
+	if err != nil {
+		return "", htmlText(document)
+	}
+
+	title := ""
+	if node := findFirst(root, atom.Title); node != nil {
+		title = collapseSpace(nodeText(node))
+	}
+	body := findFirst(root, atom.Body)
+	if body == nil {
+		body = root
+	}
+
+	content := bestContentNode(body)
+	var lines []string
+	writeBlocks(content, &lines)
+	return title, strings.Join(lines, "\n")
+}
+
+func bestContentNode(body *html.Node) *html.Node {
+	var best *html.Node
+	bestLength := 0
+	walkContent(body, func(n *html.Node) {
+		if n.DataAtom == atom.Article || n.DataAtom == atom.Main || attr(n, "role") == "main" {
+			if length := len(collapseSpace(visibleText(n))); length > bestLength {
+				best, bestLength = n, length
+			}
+		}
+	})
+	if best != nil {
+		return best
+	}
+
+	bestScore := 0.0
+	walkContent(body, func(n *html.Node) {
+		score := 0.0
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			if child.Type != html.ElementNode || (child.DataAtom != atom.P && child.DataAtom != atom.Pre && child.DataAtom != atom.Blockquote) {
+				continue
+			}
+			text := collapseSpace(visibleText(child))
+			linkText := 0
+			walkContent(child, func(a *html.Node) {
+				if a.DataAtom == atom.A {
+					linkText += len(collapseSpace(visibleText(a)))
+				}
+			})
+			score += float64(len(text) - linkText)
+		}
+		if score > bestScore {
+			best, bestScore = n, score
+		}
+	})
+	if best == nil {
+		return body
+	}
+	return best
+}
+
+// walkContent calls fn for every element under n that is not boilerplate.
+func walkContent(n *html.Node, fn func(*html.Node)) {
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		if child.Type != html.ElementNode || isBoilerplate(child) {
+			continue
+		}
+		fn(child)
+		walkContent(child, fn)
+	}
+}
+
+func isBoilerplate(n *html.Node) bool {
+	switch n.DataAtom {
+	case atom.Nav, atom.Header, atom.Footer, atom.Aside, atom.Form, atom.Button,
+		atom.Iframe, atom.Svg, atom.Script, atom.Style, atom.Noscript, atom.Template:
+		return true
+	}
+	if isHiddenTag(n.Data) {
+		return true
+	}
+	if role := attr(n, "role"); role == "navigation" || role == "banner" || role == "contentinfo" {
+		return true
+	}
+	names := attr(n, "class") + " " + attr(n, "id")
+	return boilerplatePattern.MatchString(names) && !contentPattern.MatchString(names)
+}
+
+func isBlock(n *html.Node) bool {
+	switch n.DataAtom {
+	case atom.P, atom.Div, atom.Section, atom.Article, atom.Main, atom.Li, atom.Ul, atom.Ol,
+		atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6, atom.Pre, atom.Blockquote,
+		atom.Table, atom.Tr, atom.Dl, atom.Dt, atom.Dd, atom.Figcaption, atom.Br:
+		return true
+	}
+	return false
+}
+
+// writeBlocks appends one line per block of text under n.
+func writeBlocks(n *html.Node, lines *[]string) {
+	var current strings.Builder
+	flush := func() {
+		if line := collapseSpace(current.String()); line != "" {
+			*lines = append(*lines, line)
+		}
+		current.Reset()
+	}
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			switch child.Type {
+			case html.TextNode:
+				current.WriteString(child.Data)
+			case html.ElementNode:
+				if isBoilerplate(child) {
+					continue
+				}
+				if isBlock(child) {
+					flush()
+					walk(child)
+					flush()
+				} else {
+					walk(child)
+				}
+			}
+		}
+	}
+	walk(n)
+	flush()
+}
+
+// visibleText concatenates the text under n, skipping boilerplate.
+func visibleText(n *html.Node) string {
+	var sb strings.Builder
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			switch child.Type {
+			case html.TextNode:
+				sb.WriteString(child.Data)
+				sb.WriteString(" ")
+			case html.ElementNode:
+				if !isBoilerplate(child) {
+					walk(child)
+				}
+			}
+		}
+	}
+	walk(n)
+	return sb.String()
+}
+
+func nodeText(n *html.Node) string {
+	var sb strings.Builder
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		if child.Type == html.TextNode {
+			sb.WriteString(child.Data)
+		}
+	}
+	return sb.String()
+}
+
+func findFirst(n *html.Node, a atom.Atom) *html.Node {
+	if n.Type == html.ElementNode && n.DataAtom == a {
+		return n
+	}
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		if found := findFirst(child, a); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+func collapseSpace(text string) string {
+	return strings.Join(strings.Fields(text), " ")
+}
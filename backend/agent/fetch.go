@@ -0,0 +1,391 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	defaultFetchUserAgent = "gemini-research-agent/1.0"
+	defaultFetchDelay     = time.Second
+	defaultMaxFetchPages  = 3
+	defaultMaxPageChars   = 4000
+	robotsMaxBytes        = 512 << 10
+)
+
+var ErrRobotsDisallowed = errors.New("disallowed by robots.txt")
+
+// ErrPrivateAddress is returned when a fetch would connect to a loopback,
+// private, link-local or otherwise non-public address.
+var ErrPrivateAddress = errors.New("refusing to connect to a non-public address")
+
+// publicHTTPClient is PageFetcher's default client. Its dialer checks every
+// address it connects to, after DNS resolution and on each redirect, so a
+// URL cannot reach the local network or a cloud metadata endpoint.
+var publicHTTPClient = newPublicHTTPClient()
+
+func newPublicHTTPClient() *http.Client {
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second, Control: refuseNonPublic}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &http.Client{Transport: transport}
+}
+
+func refuseNonPublic(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return err
+	}
+	if !isPublicAddr(addr) {
+		return ErrPrivateAddress
+	}
+	return nil
+}
+
+// sharedAddressSpace is the carrier-grade NAT range, RFC 6598.
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+func isPublicAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	return addr.IsGlobalUnicast() && !addr.IsPrivate() && !sharedAddressSpace.Contains(addr)
+}
+
+// Page is the readable text of a fetched web page. Truncated is set when the
+// body exceeded MaxBytes and only a prefix was read.
+type Page struct {
+	URL       string
+	Title     string
+	Text      string
+	Truncated bool
+}
+
+// PageFetcher downloads pages politely: it honours robots.txt, waits at
+// least Delay (or the site's Crawl-delay, if longer) between requests to the
+// same host, and bounds each fetch by Timeout and MaxBytes. HTML is reduced
+// to its main text with ExtractMainText.
+type PageFetcher struct {
+	// HTTPClient defaults to a client that refuses loopback, private and
+	// link-local destinations, including those reached by redirect.
+	HTTPClient *http.Client
+	UserAgent  string
+	Delay      time.Duration
+	Timeout    time.Duration
+	MaxBytes   int64
+
+	// IgnoreRobots skips robots.txt checks, e.g. for an internal mirror.
+	IgnoreRobots bool
+
+	mu       sync.Mutex
+	robots   map[string]*robotsRules
+	nextSlot map[string]time.Time
+}
+
+func (f *PageFetcher) Fetch(ctx context.Context, rawURL string) (*Page, error) {
+	parsed, err := url.Parse(rawURL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return nil, fmt.Errorf("cannot fetch %q: not an absolute http or https URL", rawURL)
+	}
+
+	timeout := f.Timeout
+	if timeout <= 0 {
+		timeout = defaultFetchTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	rules := &robotsRules{}
+	if !f.IgnoreRobots {
+		rules, err = f.robotsFor(ctx, parsed)
+		if err != nil {
+			return nil, err
+		}
+		if !rules.allowed(parsed) {
+			return nil, fmt.Errorf("%s: %w", rawURL, ErrRobotsDisallowed)
+		}
+	}
+	if err := f.wait(ctx, parsed.Host, rules.crawlDelay); err != nil {
+		return nil, err
+	}
+
+	resp, err := f.get(ctx, parsed.String())
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("fetch %s failed with status %d", rawURL, resp.StatusCode)
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	isHTML := mediaType == "text/html" || mediaType == "application/xhtml+xml"
+	if !isHTML && mediaType != "text/plain" && mediaType != "" {
+		return nil, fmt.Errorf("fetch %s: unsupported content type %s", rawURL, mediaType)
+	}
+
+	maxBytes := f.MaxBytes
+	if maxBytes <= 0 {
+		maxBytes = defaultFetchMaxBytes
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	page := &Page{URL: resp.Request.URL.String()}
+	if int64(len(body)) > maxBytes {
+		body = body[:maxBytes]
+		page.Truncated = true
+	}
+
+	if isHTML {
+		page.Title, page.Text = ExtractMainText(string(body))
+	} else {
+		page.Text = strings.TrimSpace(string(body))
+	}
+	return page, nil
+}
+
+func (f *PageFetcher) get(ctx context.Context, rawURL string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", f.userAgent())
+	httpClient := f.HTTPClient
+	if httpClient == nil {
+		httpClient = publicHTTPClient
+	}
+	return httpClient.Do(req)
+}
+
+func (f *PageFetcher) userAgent() string {
+	if f.UserAgent != "" {
+		return f.UserAgent
+	}
+	return defaultFetchUserAgent
+}
+
+// wait blocks until host may be fetched again and reserves the next slot, so
+// concurrent fetches to one host are spaced out too.
+func (f *PageFetcher) wait(ctx context.Context, host string, crawlDelay time.Duration) error {
+	delay := f.Delay
+	if delay <= 0 {
+		delay = defaultFetchDelay
+	}
+	delay = max(delay, crawlDelay)
+
+	f.mu.Lock()
+	if f.nextSlot == nil {
+		f.nextSlot = make(map[string]time.Time)
+	}
+	now := time.Now()
+	slot := f.nextSlot[host]
+	if slot.Before(now) {
+		slot = now
+	}
+	f.nextSlot[host] = slot.Add(delay)
+	f.mu.Unlock()
+
+	if wait := time.Until(slot); wait > 0 {
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+	return nil
+}
+
+// robotsFor returns the cached robots.txt rules for u's host, fetching them
+// on first use. A missing robots.txt allows everything; a server error
+// disallows everything, as RFC 9309 asks.
+func (f *PageFetcher) robotsFor(ctx context.Context, u *url.URL) (*robotsRules, error) {
+	key := u.Scheme + "://" + u.Host
+	f.mu.Lock()
+	rules, ok := f.robots[key]
+	f.mu.Unlock()
+	if ok {
+		return rules, nil
+	}
+
+	resp, err := f.get(ctx, key+"/robots.txt")
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch robots.txt for %s: %w", u.Host, err)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode <= 299:
+		body, err := io.ReadAll(io.LimitReader(resp.Body, robotsMaxBytes))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read robots.txt for %s: %w", u.Host, err)
+		}
+		rules = parseRobots(string(body), f.userAgent())
+	case resp.StatusCode >= 500:
+		rules = &robotsRules{disallowAll: true}
+	default:
+		rules = &robotsRules{}
+	}
+
+	f.mu.Lock()
+	if f.robots == nil {
+		f.robots = make(map[string]*robotsRules)
+	}
+	f.robots[key] = rules
+	f.mu.Unlock()
+	return rules, nil
+}
+
+type robotsRule struct {
+	allow   bool
+	pattern string
+}
+
+type robotsRules struct {
+	rules       []robotsRule
+	crawlDelay  time.Duration
+	disallowAll bool
+}
+
+// parseRobots keeps the rules of the group that names userAgent's product
+// token, falling back to the "*" group.
+func parseRobots(body, userAgent string) *robotsRules {
+	token := strings.ToLower(userAgent)
+	if i := strings.IndexAny(token, "/ "); i >= 0 {
+		token = token[:i]
+	}
+
+	var specific, wildcard *robotsRules
+	var current []*robotsRules
+	inAgents := false
+	for _, line := range strings.Split(body, "\n") {
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+
+		if key == "user-agent" {
+			if !inAgents {
+				current = nil
+			}
+			inAgents = true
+			agent := strings.ToLower(value)
+			switch {
+			case agent == "*":
+				if wildcard == nil {
+					wildcard = &robotsRules{}
+				}
+				current = append(current, wildcard)
+			case agent == token:
+				if specific == nil {
+					specific = &robotsRules{}
+				}
+				current = append(current, specific)
+			}
+			continue
+		}
+		inAgents = false
+
+		for _, group := range current {
+			switch key {
+			case "allow", "disallow":
+				if value != "" {
+					group.rules = append(group.rules, robotsRule{allow: key == "allow", pattern: value})
+				}
+			case "crawl-delay":
+				if seconds, err := strconv.ParseFloat(value, 64); err == nil {
+					group.crawlDelay = time.Duration(seconds * float64(time.Second))
+				}
+			}
+		}
+	}
+
+	switch {
+	case specific != nil:
+		return specific
+	case wildcard != nil:
+		return wildcard
+	}
+	return &robotsRules{}
+}
+
+// allowed applies the most specific (longest) matching rule; allow wins a
+// tie. Paths with no matching rule are allowed.
+func (r *robotsRules) allowed(u *url.URL) bool {
+	if r.disallowAll {
+		return false
+	}
+	path := u.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	if u.RawQuery != "" {
+		path += "?" + u.RawQuery
+	}
+
+	allow, matched := true, -1
+	for _, rule := range r.rules {
+		if !robotsMatch(rule.pattern, path) {
+			continue
+		}
+		if length := len(rule.pattern); length > matched || (length == matched && rule.allow) {
+			allow, matched = rule.allow, length
+		}
+	}
+	return allow
+}
+
+// robotsMatch matches path against a robots.txt pattern, where "*" matches
+// any sequence and a trailing "$" anchors the end.
+func robotsMatch(pattern, path string) bool {
+	anchored := strings.HasSuffix(pattern, "$")
+	pattern = strings.TrimSuffix(pattern, "$")
+	parts := strings.Split(pattern, "*")
+
+	if !strings.HasPrefix(path, parts[0]) {
+		return false
+	}
+	position := len(parts[0])
+	for i, part := range parts[1:] {
+		last := i == len(parts)-2
+		if last && anchored {
+			return strings.HasSuffix(path[position:], part)
+		}
+		index := strings.Index(path[position:], part)
+		if index < 0 {
+			return false
+		}
+		position += index + len(part)
+	}
+	return !anchored || position == len(path)
+}
+
+func truncateRunes(text string, maxChars int) string {
+	if runes := []rune(text); len(runes) > maxChars {
+		return string(runes[:maxChars])
+	}
+	return text
+}
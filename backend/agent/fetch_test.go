@@ -0,0 +1,106 @@
+package agent
+
+import (
+	"net/netip"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestRobotsMatch(t *testing.T) {
+	tests := []struct {
+		pattern, path string
+		want          bool
+	}{
+		{"/", "/anything", true},
+		{"/private", "/private/page", true},
+		{"/private", "/public", false},
+		{"/*.pdf", "/docs/report.pdf", true},
+		{"/*.pdf$", "/docs/report.pdf", true},
+		{"/*.pdf$", "/docs/report.pdf?download=1", false},
+		{"/search$", "/search", true},
+		{"/search$", "/search/more", false},
+		{"/a*b*c", "/a-x-b-y-c-z", true},
+		{"/a*b*c", "/a-x-c-y-b", false},
+	}
+	for _, tt := range tests {
+		if got := robotsMatch(tt.pattern, tt.path); got != tt.want {
+			t.Errorf("robotsMatch(%q, %q) = %v, want %v", tt.pattern, tt.path, got, tt.want)
+		}
+	}
+}
+
+const testRobots = `# comment
+User-agent: *
+Disallow: /private
+Allow: /private/open
+Crawl-delay: 2
+
+User-agent: other-bot
+User-agent: gemini-research-agent
+Disallow: /
+Allow: /docs/
+Allow: /docs/secret$
+Disallow: /docs/secret
+Crawl-delay: 0.5
+`
+
+func TestParseRobots(t *testing.T) {
+	tests := []struct {
+		userAgent string
+		path      string
+		want      bool
+	}{
+		{"some-crawler/2.0", "/public", true},
+		{"some-crawler/2.0", "/private/page", false},
+		{"some-crawler/2.0", "/private/open/page", true},
+		{defaultFetchUserAgent, "/public", false},
+		{defaultFetchUserAgent, "/docs/guide", true},
+		// Equally long allow and disallow rules: allow wins.
+		{defaultFetchUserAgent, "/docs/secret", true},
+		{"Other-Bot", "/docs/guide", true},
+	}
+	for _, tt := range tests {
+		rules := parseRobots(testRobots, tt.userAgent)
+		if got := rules.allowed(&url.URL{Path: tt.path}); got != tt.want {
+			t.Errorf("%s allowed(%q) = %v, want %v", tt.userAgent, tt.path, got, tt.want)
+		}
+	}
+
+	if delay := parseRobots(testRobots, "some-crawler").crawlDelay; delay != 2*time.Second {
+		t.Errorf("wildcard crawl delay = %v", delay)
+	}
+	if delay := parseRobots(testRobots, defaultFetchUserAgent).crawlDelay; delay != 500*time.Millisecond {
+		t.Errorf("specific crawl delay = %v", delay)
+	}
+	if rules := parseRobots("", defaultFetchUserAgent); !rules.allowed(&url.URL{Path: "/"}) {
+		t.Error("empty robots.txt disallows")
+	}
+}
+
+func TestIsPublicAddr(t *testing.T) {
+	tests := []struct {
+		addr string
+		want bool
+	}{
+		{"93.184.215.14", true},
+		{"2606:4700::6810:84e5", true},
+		{"127.0.0.1", false},
+		{"::1", false},
+		{"10.1.2.3", false},
+		{"172.16.0.1", false},
+		{"192.168.1.1", false},
+		{"169.254.169.254", false},
+		{"100.64.0.1", false},
+		{"0.0.0.0", false},
+		{"fe80::1", false},
+		{"fd00::1", false},
+		{"::ffff:127.0.0.1", false},
+		{"224.0.0.1", false},
+	}
+	for _, tt := range tests {
+		if got := isPublicAddr(netip.MustParseAddr(tt.addr)); got != tt.want {
+			t.Errorf("isPublicAddr(%s) = %v, want %v", tt.addr, got, tt.want)
+		}
+	}
+}
@@ -10,6 +10,19 @@ import (
 
 const GraphEnd = "__END__"
 
+type nodeNameKey struct{}
+
+// WithNodeName returns a context that records the graph node being executed.
+func WithNodeName(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, nodeNameKey{}, name)
+}
+
+// NodeNameFromContext returns the node name set by WithNodeName, or "".
+func NodeNameFromContext(ctx context.Context) string {
+	name, _ := ctx.Value(nodeNameKey{}).(string)
+	return name
+}
+
 type GraphNodeFunc[S any] func(ctx context.Context, state S) (S, string, error)
 
 type EdgeConfig[S any] struct {
@@ -89,12 +102,16 @@ func (g *Graph[S]) Execute(ctx context.Context, initialState S, maxIterations in
 			return currentState, fmt.Errorf("node '%s' not found in graph definition", currentNodeName)
 		}
 
+		nodeCtx := WithNodeName(ctx, currentNodeName)
+		emitEvent(nodeCtx, Event{Type: EventNodeStart})
+
 		// Node function now directly works with the generic state type S
-		updatedState, _, err := nodeFunc(ctx, currentState)
+		updatedState, _, err := nodeFunc(nodeCtx, currentState)
 		if err != nil {
 			return currentState, fmt.Errorf("error executing node '%s': %w", currentNodeName, err)
 		}
 		currentState = updatedState
+		emitEvent(nodeCtx, Event{Type: EventNodeEnd})
 
 		fmt.Println(color.CyanString("Finished running: %s", currentNodeName))
 
@@ -108,7 +125,7 @@ func (g *Graph[S]) Execute(ctx context.Context, initialState S, maxIterations in
 		var routingDecision string
 		if edgeConfig.IsConditional {
 			// Router function also directly works with the generic state type S
-			_, decisionFromRouterFunc, routerErr := edgeConfig.RouterFunc(ctx, currentState)
+			_, decisionFromRouterFunc, routerErr := edgeConfig.RouterFunc(nodeCtx, currentState)
 			if routerErr != nil {
 				return currentState, fmt.Errorf("error executing router function for node '%s': %w", currentNodeName, routerErr)
 			}
@@ -136,3 +153,9 @@ func (g *Graph[S]) Execute(ctx context.Context, initialState S, maxIterations in
 	fmt.Printf("\n--- Workflow Execution Finished ---\nFinal State: %+v\n", currentState)
 	return currentState, nil
 }
+
+// Stream runs Execute and passes node transitions and model thought summaries
+// to handler as they happen.
+func (g *Graph[S]) Stream(ctx context.Context, initialState S, maxIterations int, handler EventHandler) (S, error) {
+	return g.Execute(WithEventHandler(ctx, handler), initialState, maxIterations)
+}
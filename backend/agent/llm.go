@@ -0,0 +1,393 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+const defaultGeminiBaseURL = "https://generativelanguage.googleapis.com/v1beta"
+
+type FunctionCall struct {
+	Name string         `json:"name"`
+	Args map[string]any `json:"args,omitempty"`
+}
+
+type FunctionResponse struct {
+	Name     string         `json:"name"`
+	Response map[string]any `json:"response"`
+}
+
+type Part struct {
+	Text             string            `json:"text,omitempty"`
+	Thought          bool              `json:"thought,omitempty"`
+	FunctionCall     *FunctionCall     `json:"functionCall,omitempty"`
+	FunctionResponse *FunctionResponse `json:"functionResponse,omitempty"`
+}
+
+type Content struct {
+	Role  string `json:"role,omitempty"`
+	Parts []Part `json:"parts"`
+}
+
+type GenerationConfig struct {
+	Temperature      *float64        `json:"temperature,omitempty"`
+	ResponseMIMEType string          `json:"responseMimeType,omitempty"`
+	ThinkingConfig   *ThinkingConfig `json:"thinkingConfig,omitempty"`
+}
+
+// ThinkingConfig controls reasoning on thinking models. ThinkingBudget caps
+// thinking tokens: nil leaves the model default, 0 disables thinking and -1
+// lets the model decide. IncludeThoughts asks for thought summaries.
+type ThinkingConfig struct {
+	ThinkingBudget  *int `json:"thinkingBudget,omitempty"`
+	IncludeThoughts bool `json:"includeThoughts,omitempty"`
+}
+
+func (t ThinkingConfig) isZero() bool {
+	return t.ThinkingBudget == nil && !t.IncludeThoughts
+}
+
+// supportsThinking reports whether model accepts a thinkingConfig. Gemini 1.x
+// and 2.0 models reject it.
+func supportsThinking(model string) bool {
+	model = strings.TrimPrefix(model, "models/")
+	return !strings.HasPrefix(model, "gemini-1.") && !strings.HasPrefix(model, "gemini-2.0")
+}
+
+type GenerateContentRequest struct {
+	Contents          []Content         `json:"contents"`
+	SystemInstruction *Content          `json:"systemInstruction,omitempty"`
+	Tools             []map[string]any  `json:"tools,omitempty"`
+	SafetySettings    []SafetySetting   `json:"safetySettings,omitempty"`
+	GenerationConfig  *GenerationConfig `json:"generationConfig,omitempty"`
+}
+
+type GeminiCandidate struct {
+	Content           Content           `json:"content"`
+	FinishReason      string            `json:"finishReason,omitempty"`
+	SafetyRatings     []SafetyRating    `json:"safetyRatings,omitempty"`
+	GroundingMetadata GroundingMetadata `json:"groundingMetadata"`
+}
+
+type PromptFeedback struct {
+	BlockReason   string         `json:"blockReason,omitempty"`
+	SafetyRatings []SafetyRating `json:"safetyRatings,omitempty"`
+}
+
+type GeminiResponse struct {
+	Candidates     []GeminiCandidate `json:"candidates"`
+	PromptFeedback *PromptFeedback   `json:"promptFeedback,omitempty"`
+	UsageMetadata  *UsageMetadata    `json:"usageMetadata,omitempty"`
+	ModelVersion   string            `json:"modelVersion,omitempty"`
+	Text           string            `json:"text,omitempty"`
+	Thoughts       string            `json:"thoughts,omitempty"`
+
+	// Model is the model that served the response, which differs from the
+	// requested one after a fallback. It is set by ChatGoogleGenerativeAI.
+	Model string `json:"-"`
+
+	// Cached is set by CachedGenerator when the response was served from
+	// the cache.
+	Cached bool `json:"-"`
+}
+
+// GoogleSearchTool enables Google Search grounding for a request.
+var GoogleSearchTool = map[string]any{"google_search": map[string]any{}}
+
+// ContentGenerator issues a single generateContent call. GeminiClient talks to
+// the API; other implementations wrap one to add behaviour such as rate
+// limiting.
+type ContentGenerator interface {
+	GenerateContent(ctx context.Context, model string, req *GenerateContentRequest) (*GeminiResponse, error)
+}
+
+// GeminiClient performs single generateContent calls against the Gemini REST
+// API, or against Vertex AI when Vertex is set. Retries are handled by the
+// caller.
+type GeminiClient struct {
+	APIKey     string
+	BaseURL    string
+	HTTPClient *http.Client
+
+	// Vertex routes calls to the Vertex AI publisher model endpoint,
+	// authenticated with bearer tokens from TokenSource instead of APIKey.
+	Vertex      *VertexEndpoint
+	TokenSource TokenSource
+}
+
+func (c *GeminiClient) GenerateContent(ctx context.Context, model string, req *GenerateContentRequest) (*GeminiResponse, error) {
+	var response GeminiResponse
+	if err := c.post(ctx, model, "generateContent", req, &response); err != nil {
+		return nil, err
+	}
+	if len(response.Candidates) > 0 {
+		var text, thoughts strings.Builder
+		for _, part := range response.Candidates[0].Content.Parts {
+			if part.Thought {
+				thoughts.WriteString(part.Text)
+			} else {
+				text.WriteString(part.Text)
+			}
+		}
+		response.Text = text.String()
+		response.Thoughts = thoughts.String()
+	}
+	return &response, nil
+}
+
+// post sends req as JSON to the model's method, e.g. "generateContent", and
+// decodes the response into out. Non-2xx responses become *APIError.
+func (c *GeminiClient) post(ctx context.Context, model, method string, req, out any) error {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	model = strings.TrimPrefix(model, "models/")
+	var url string
+	if c.Vertex != nil {
+		url = c.Vertex.modelURL(c.BaseURL, model, method)
+	} else {
+		baseURL := c.BaseURL
+		if baseURL == "" {
+			baseURL = defaultGeminiBaseURL
+		}
+		url = fmt.Sprintf("%s/models/%s:%s", strings.TrimRight(baseURL, "/"), model, method)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to build request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	if c.TokenSource != nil {
+		token, err := c.TokenSource.Token(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to get access token: %w", err)
+		}
+		httpReq.Header.Set("Authorization", "Bearer "+token)
+	} else {
+		httpReq.Header.Set("x-goog-api-key", c.APIKey)
+	}
+
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(httpReq)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return NewAPIError(resp.StatusCode, resp.Header, respBody)
+	}
+
+	if err := json.Unmarshal(respBody, out); err != nil {
+		return fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+	return nil
+}
+
+type ChatGoogleGenerativeAI struct {
+	Model            string
+	Temperature      float64
+	MaxRetries       int
+	APIKey           string
+	StructuredOutput bool
+	Tools            []map[string]any
+	SafetySettings   []SafetySetting
+	Thinking         ThinkingConfig
+	Client           ContentGenerator
+
+	// FallbackModels are tried in order when Model is rate limited,
+	// overloaded or unavailable.
+	FallbackModels []string
+}
+
+func (llm *ChatGoogleGenerativeAI) WithStructuredOutput(outputSchema interface{}) *ChatGoogleGenerativeAI {
+	newLLM := *llm
+	newLLM.StructuredOutput = true
+	return &newLLM
+}
+
+// WithModels returns a copy that uses models[0] and falls back to the rest.
+func (llm *ChatGoogleGenerativeAI) WithModels(models []string) *ChatGoogleGenerativeAI {
+	newLLM := *llm
+	if len(models) > 0 {
+		newLLM.Model = models[0]
+		newLLM.FallbackModels = append([]string(nil), models[1:]...)
+	}
+	return &newLLM
+}
+
+func (llm *ChatGoogleGenerativeAI) WithTools(tools ...map[string]any) *ChatGoogleGenerativeAI {
+	newLLM := *llm
+	newLLM.Tools = tools
+	return &newLLM
+}
+
+// WithThinking returns a copy of llm that sends thinking with every request
+// to a model that supports it.
+func (llm *ChatGoogleGenerativeAI) WithThinking(thinking ThinkingConfig) *ChatGoogleGenerativeAI {
+	newLLM := *llm
+	newLLM.Thinking = thinking
+	return &newLLM
+}
+
+// Generate sends prompt as a single user turn and returns the raw response.
+func (llm *ChatGoogleGenerativeAI) Generate(ctx context.Context, prompt string) (*GeminiResponse, error) {
+	return llm.GenerateMessages(ctx, []Message{HumanMessage{Content: prompt}})
+}
+
+// GenerateMessages sends messages as a multi-turn conversation and returns the
+// raw response. Transient failures are retried up to MaxRetries times per
+// model before moving on to the next of FallbackModels.
+func (llm *ChatGoogleGenerativeAI) GenerateMessages(ctx context.Context, messages []Message) (*GeminiResponse, error) {
+	var client ContentGenerator = &GeminiClient{APIKey: llm.APIKey}
+	if llm.Client != nil {
+		client = llm.Client
+	}
+
+	systemInstruction, contents := MessagesToContents(messages)
+	temperature := llm.Temperature
+	req := &GenerateContentRequest{
+		Contents:          contents,
+		SystemInstruction: systemInstruction,
+		Tools:             llm.Tools,
+		SafetySettings:    llm.SafetySettings,
+		GenerationConfig:  &GenerationConfig{Temperature: &temperature},
+	}
+	if llm.StructuredOutput {
+		req.GenerationConfig.ResponseMIMEType = "application/json"
+	}
+
+	models := append([]string{llm.Model}, llm.FallbackModels...)
+	var err error
+	for i, model := range models {
+		modelReq := req
+		if !llm.Thinking.isZero() && supportsThinking(model) {
+			withThinking := *req
+			generationConfig := *req.GenerationConfig
+			thinking := llm.Thinking
+			generationConfig.ThinkingConfig = &thinking
+			withThinking.GenerationConfig = &generationConfig
+			modelReq = &withThinking
+		}
+
+		var response *GeminiResponse
+		response, err = retry(ctx, RetryPolicy{MaxRetries: llm.MaxRetries}, func() (*GeminiResponse, error) {
+			return client.GenerateContent(ctx, model, modelReq)
+		})
+		if err == nil {
+			if err := checkResponse(response); err != nil {
+				return nil, err
+			}
+			response.Model = model
+			if response.Thoughts != "" {
+				emitEvent(ctx, Event{Type: EventThought, Model: model, Text: response.Thoughts})
+			}
+			return response, nil
+		}
+		if i < len(models)-1 && !shouldFallback(err) {
+			break
+		}
+	}
+	return nil, err
+}
+
+// shouldFallback reports whether another model might succeed where this one
+// failed: it was rate limited, out of quota, overloaded or does not exist.
+func shouldFallback(err error) bool {
+	var rateLimited *ErrRateLimited
+	var quotaExceeded *ErrQuotaExceeded
+	if errors.As(err, &rateLimited) || errors.As(err, &quotaExceeded) {
+		return true
+	}
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		switch apiErr.StatusCode {
+		case http.StatusNotFound, http.StatusInternalServerError, http.StatusBadGateway,
+			http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return true
+		}
+	}
+	return false
+}
+
+func (llm *ChatGoogleGenerativeAI) Invoke(ctx context.Context, prompt string) (AIMessage, error) {
+	return llm.InvokeMessages(ctx, []Message{HumanMessage{Content: prompt}})
+}
+
+func (llm *ChatGoogleGenerativeAI) InvokeMessages(ctx context.Context, messages []Message) (AIMessage, error) {
+	response, err := llm.GenerateMessages(ctx, messages)
+	if err != nil {
+		return AIMessage{}, err
+	}
+	message := AIMessage{Content: response.Text, Thoughts: response.Thoughts, Model: response.Model, UsageMetadata: response.UsageMetadata, Cached: response.Cached}
+	if len(response.Candidates) > 0 {
+		message.FinishReason = response.Candidates[0].FinishReason
+		for _, part := range response.Candidates[0].Content.Parts {
+			if part.FunctionCall != nil {
+				message.ToolCalls = append(message.ToolCalls, ToolCall{Name: part.FunctionCall.Name, Args: part.FunctionCall.Args})
+			}
+		}
+	}
+	return message, nil
+}
+
+// MessagesToContents converts a conversation into Gemini contents. System
+// messages are merged into a separate system instruction, AI messages become
+// "model" turns, tool results become function responses, and consecutive
+// messages with the same role are merged into one turn.
+func MessagesToContents(messages []Message) (*Content, []Content) {
+	var systemInstruction *Content
+	var contents []Content
+
+	for _, message := range messages {
+		var role string
+		var parts []Part
+		switch m := message.(type) {
+		case SystemMessage:
+			if systemInstruction == nil {
+				systemInstruction = &Content{}
+			}
+			systemInstruction.Parts = append(systemInstruction.Parts, Part{Text: m.Content})
+			continue
+		case AIMessage:
+			role = "model"
+			if m.Content != "" {
+				parts = append(parts, Part{Text: m.Content})
+			}
+			for _, call := range m.ToolCalls {
+				parts = append(parts, Part{FunctionCall: &FunctionCall{Name: call.Name, Args: call.Args}})
+			}
+		case ToolMessage:
+			role = "user"
+			parts = []Part{{FunctionResponse: &FunctionResponse{
+				Name:     m.Name,
+				Response: map[string]any{"content": m.Content},
+			}}}
+		default:
+			role, parts = "user", []Part{{Text: message.GetContent()}}
+		}
+
+		if n := len(contents); n > 0 && contents[n-1].Role == role {
+			contents[n-1].Parts = append(contents[n-1].Parts, parts...)
+			continue
+		}
+		contents = append(contents, Content{Role: role, Parts: parts})
+	}
+	return systemInstruction, contents
+}
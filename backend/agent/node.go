@@ -3,131 +3,180 @@ package agent
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"strings"
+	"sync"
 )
 
-type ChatGoogleGenerativeAI struct {
-	Model            string
-	Temperature      float64
-	MaxRetries       int
-	APIKey           string
-	StructuredOutput bool
+type Nodes struct {
+	config            *Configuration
+	cache             *CachedGenerator
+	limiter           *RateLimiter
+	tools             *ToolRegistry
+	search            SearchProvider
+	fetcher           *PageFetcher
+	embedder          Embedder
+	prompts           *PromptRegistry
+	webSearchLLM      *ChatGoogleGenerativeAI
+	queryGeneratorLLM *ChatGoogleGenerativeAI
+	reasoningLLM      *ChatGoogleGenerativeAI
 }
 
-func (llm *ChatGoogleGenerativeAI) WithStructuredOutput(outputSchema interface{}) *ChatGoogleGenerativeAI {
-	newLLM := *llm
-	newLLM.StructuredOutput = true
-	return &newLLM
+func NewNodes(config *Configuration, apiKey string) *Nodes {
+	return NewNodesWithClient(config, &GeminiClient{APIKey: apiKey})
 }
 
-func (llm *ChatGoogleGenerativeAI) Invoke(prompt string) (AIMessage, error) {
-	if llm.StructuredOutput {
-		if strings.Contains(prompt, "query_writer_instructions") {
-			return AIMessage{Content: `{"query": [{"Query": "mock query 1", "Rationale": "mock reason 1"}, {"Query": "mock query 2", "Rationale": "mock reason 2"}]}`}, nil
-		}
-		if strings.Contains(prompt, "reflection_instructions") {
-			return AIMessage{Content: `{"is_sufficient": false, "knowledge_gap": "more info needed", "follow_up_queries": ["follow up query 1", "follow up query 2"]}`}, nil
-		}
-		return AIMessage{Content: `{}`}, nil
+// NewNodesWithClient builds the nodes on top of an existing ContentGenerator,
+// such as a fake model in tests. Rate limiting and caching from config are
+// layered on top of client.
+func NewNodesWithClient(config *Configuration, client ContentGenerator) *Nodes {
+	var limiter *RateLimiter
+	if len(config.RateLimits) > 0 {
+		limiter = NewRateLimiter(config.RateLimits)
+		client = &RateLimitedGenerator{Next: client, Limiter: limiter}
+	}
+	var cache *CachedGenerator
+	switch config.Cache {
+	case "memory":
+		cache = &CachedGenerator{Next: client, Store: NewMemoryCache(), TTL: config.CacheTTL, Bypass: config.CacheBypass}
+		client = cache
+	case "file":
+		cache = &CachedGenerator{Next: client, Store: &FileCache{Dir: config.CacheDir}, TTL: config.CacheTTL, Bypass: config.CacheBypass}
+		client = cache
 	}
-	return AIMessage{Content: "This is a mock LLM response to: " + prompt}, nil
+	nodes := &Nodes{
+		config:  config,
+		cache:   cache,
+		limiter: limiter,
+		prompts: NewPromptRegistry(),
+		webSearchLLM: &ChatGoogleGenerativeAI{
+			Model:          config.QueryGeneratorModel,
+			Temperature:    0,
+			MaxRetries:     2,
+			Tools:          []map[string]any{GoogleSearchTool},
+			Client:         client,
+			SafetySettings: config.SafetySettings,
+		},
+		queryGeneratorLLM: &ChatGoogleGenerativeAI{
+			Model:          config.QueryGeneratorModel,
+			Temperature:    1.0,
+			MaxRetries:     2,
+			Client:         client,
+			SafetySettings: config.SafetySettings,
+		},
+		reasoningLLM: &ChatGoogleGenerativeAI{
+			Model:          config.ReasoningModel,
+			Temperature:    1.0,
+			MaxRetries:     2,
+			Client:         client,
+			SafetySettings: config.SafetySettings,
+		},
+	}
+	nodes.search = &GeminiSearchProvider{LLM: nodes.webSearchLLM.WithModels(config.queryGeneratorChain())}
+	if config.FetchPages {
+		nodes.fetcher = &PageFetcher{Delay: config.FetchDelay, Timeout: config.FetchTimeout, MaxBytes: config.FetchMaxBytes}
+	}
+	return nodes
 }
 
-type GeminiClient struct {
-	APIKey string
+// SetTools makes the tools in registry available to the answer model. A nil
+// registry disables tool calling.
+func (n *Nodes) SetTools(registry *ToolRegistry) {
+	n.tools = registry
 }
 
-type GeminiGenerateContentConfig struct {
-	Tools       []map[string]any `json:"tools"`
-	Temperature float64          `json:"temperature"`
+// SetSearchProvider replaces the provider WebResearchNode searches with.
+func (n *Nodes) SetSearchProvider(provider SearchProvider) {
+	n.search = provider
 }
 
-type GeminiCandidate struct {
-	GroundingMetadata GroundingMetadata `json:"grounding_metadata"`
+// SetPageFetcher replaces the fetcher used to read the top search results.
+// A nil fetcher disables page fetching.
+func (n *Nodes) SetPageFetcher(fetcher *PageFetcher) {
+	n.fetcher = fetcher
 }
 
-type GeminiResponse struct {
-	Candidates []GeminiCandidate `json:"candidates"`
-	Text       string            `json:"text"`
+// SetEmbedder sets the embedder used to detect near-duplicate follow-up
+// queries. A nil embedder leaves only the lexical check.
+func (n *Nodes) SetEmbedder(embedder Embedder) {
+	n.embedder = embedder
 }
 
-func (c *GeminiClient) GenerateContent(model string, contents string, config GeminiGenerateContentConfig) (GeminiResponse, error) {
-	mockGroundingChunks := []GroundingChunk{
-		{Web: struct {
-			URI   string `json:"uri"`
-			Title string `json:"title"`
-		}{URI: "https://example.com/doc1", Title: "Document One.pdf"}},
-		{Web: struct {
-			URI   string `json:"uri"`
-			Title string `json:"title"`
-		}{URI: "https://example.com/doc2", Title: "Another Doc.html"}},
-	}
-	mockGroundingSupports := []GroundingSupport{
-		{Segment: struct {
-			StartIndex int `json:"start_index"`
-			EndIndex   int `json:"end_index"`
-		}{StartIndex: 10, EndIndex: 20}, GroundingChunkIndices: []int{0}},
-		{Segment: struct {
-			StartIndex int `json:"start_index"`
-			EndIndex   int `json:"end_index"`
-		}{StartIndex: 30, EndIndex: 45}, GroundingChunkIndices: []int{1}},
-	}
-
-	return GeminiResponse{
-		Text: "Mock web research result for: " + contents + " [1] [2]",
-		Candidates: []GeminiCandidate{
-			{GroundingMetadata: GroundingMetadata{
-				GroundingSupports: mockGroundingSupports,
-				GroundingChunks:   mockGroundingChunks,
-			}},
-		},
-	}, nil
+// SetPrompts replaces the prompt registry. The run uses the set named by
+// Configuration.PromptSet.
+func (n *Nodes) SetPrompts(registry *PromptRegistry) {
+	n.prompts = registry
 }
 
-type Nodes struct {
-	config            *Configuration
-	geminiClient      *GeminiClient
-	queryGeneratorLLM *ChatGoogleGenerativeAI
-	reasoningLLM      *ChatGoogleGenerativeAI
+// promptSet returns the run's prompt set and records which one it is in
+// state.
+func (n *Nodes) promptSet(state *OverallState) (*PromptSet, error) {
+	set, err := n.prompts.Get(n.config.PromptSet)
+	if err != nil {
+		return nil, err
+	}
+	state.PromptSet = set.Name
+	state.PromptVersion = set.Version
+	return set, nil
 }
 
-func NewNodes(config *Configuration, apiKey string) *Nodes {
-	return &Nodes{
-		config:       config,
-		geminiClient: &GeminiClient{APIKey: apiKey},
-		queryGeneratorLLM: &ChatGoogleGenerativeAI{
-			Model:       config.QueryGeneratorModel,
-			Temperature: 1.0,
-			MaxRetries:  2,
-			APIKey:      apiKey,
-		},
-		reasoningLLM: &ChatGoogleGenerativeAI{
-			Model:       config.ReasoningModel,
-			Temperature: 1.0,
-			MaxRetries:  2,
-			APIKey:      apiKey,
-		},
+// CacheStats reports response cache hits and misses. It is zero when the
+// cache is disabled.
+func (n *Nodes) CacheStats() CacheStats {
+	if n.cache == nil {
+		return CacheStats{}
+	}
+	return n.cache.Stats()
+}
+
+// recordUsage attributes a model call to the running node and flags the run
+// once it is over budget. cached reports a response cache hit; lookups are
+// only counted when the cache is enabled.
+func (n *Nodes) recordUsage(ctx context.Context, state *OverallState, model string, usage *UsageMetadata, cached bool) {
+	state.Usage.Record(NodeNameFromContext(ctx), model, usage, n.config.Prices)
+	if n.cache != nil {
+		state.Usage.RecordCacheLookup(cached)
+	}
+	if n.config.budgetExceeded(state.Usage) {
+		state.BudgetExceeded = true
 	}
 }
 
+// withInstructions sends the rendered prompt as the system instruction so the
+// thread itself goes to the model as conversation turns.
+func withInstructions(instructions string, messages []Message) []Message {
+	return append([]Message{SystemMessage{Content: instructions}}, messages...)
+}
+
 func (n *Nodes) GenerateQueryNode(ctx context.Context, state *OverallState) (*OverallState, string, error) {
 	if state.InitialSearchQueryCount == 0 {
 		state.InitialSearchQueryCount = n.config.NumberOfInitialQueries
 	}
 
-	structured_llm := n.queryGeneratorLLM.WithStructuredOutput(SearchQueryList{})
+	structured_llm := n.queryGeneratorLLM.WithModels(n.config.queryGeneratorChain()).WithStructuredOutput(SearchQueryList{})
 
 	current_date := GetCurrentDate()
-	researchTopic := GetResearchTopic(state.Messages)
+	researchTopic := GetLatestQuestion(state.Messages)
 
-	formatted_prompt := fmt.Sprintf(QueryWriterInstructions,
-		state.InitialSearchQueryCount, researchTopic, current_date)
+	prompts, err := n.promptSet(state)
+	if err != nil {
+		return nil, "", err
+	}
+	formatted_prompt, err := prompts.QueryWriter.Render(QueryWriterPromptData{
+		CurrentDate:   current_date,
+		ResearchTopic: researchTopic,
+		NumberQueries: state.InitialSearchQueryCount,
+	})
+	if err != nil {
+		return nil, "", err
+	}
 
-	result, err := structured_llm.Invoke(formatted_prompt)
+	result, err := structured_llm.InvokeMessages(ctx, withInstructions(formatted_prompt, state.Messages))
 	if err != nil {
 		return nil, "", fmt.Errorf("failed to generate query: %w", err)
 	}
+	n.recordUsage(ctx, state, result.Model, result.UsageMetadata, result.Cached)
 
 	var sqList SearchQueryList
 	err = json.Unmarshal([]byte(result.Content), &sqList)
@@ -135,7 +184,6 @@ func (n *Nodes) GenerateQueryNode(ctx context.Context, state *OverallState) (*Ov
 		return nil, "", fmt.Errorf("failed to unmarshal SearchQueryList: %w", err)
 	}
 
-	state.Messages = append(state.Messages, AIMessage{Content: result.Content})
 	state.InitialSearchQueryCount = n.config.NumberOfInitialQueries
 	state.SearchQueries = sqList.Query
 	return state, "web_research", nil
@@ -149,48 +197,85 @@ func (n *Nodes) WebResearchNode(ctx context.Context, state *OverallState) (*Over
 		state.SearchQueries = []Query{}
 	}
 
+	prompts, err := n.promptSet(state)
+	if err != nil {
+		return nil, "", err
+	}
+
+	policy := n.config.domainPolicy()
+	if state.Citations == nil {
+		state.Citations = NewCitationRegistry()
+	}
+
 	queriesToProcess := state.SearchQueries
 	state.SearchQueries = []Query{} // Clear for tracking actual ran queries in this loop
 
-	for idx, query := range queriesToProcess {
-		formatted_prompt := fmt.Sprintf(WebSearcherInstructions, query.Query, GetCurrentDate())
-
-		response, err := n.geminiClient.GenerateContent(
-			n.config.QueryGeneratorModel,
-			formatted_prompt,
-			GeminiGenerateContentConfig{
-				Tools:       []map[string]any{{"Google Search": map[string]any{}}},
-				Temperature: 0,
-			},
-		)
-		if err != nil {
-			return nil, "", fmt.Errorf("error during web search for query '%s': %w", query.Query, err)
-		}
+	// Workers share state only through record, which also lets the
+	// dispatcher stop handing out queries once the run is over budget.
+	var mu sync.Mutex
+	record := func(model string, usage *UsageMetadata, cached bool) {
+		mu.Lock()
+		defer mu.Unlock()
+		n.recordUsage(ctx, state, model, usage, cached)
+	}
+	overBudget := func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return state.BudgetExceeded
+	}
 
-		resolved_urls := ResolveURLs(response.Candidates[0].GroundingMetadata.GroundingChunks, idx)
-		citations := GetCitations(&LLMResponse{
-			Candidates: []struct {
-				GroundingMetadata GroundingMetadata `json:"grounding_metadata"`
-			}{
-				{GroundingMetadata: response.Candidates[0].GroundingMetadata},
-			},
-			Text: response.Text,
-		}, resolved_urls)
-		modified_text := InsertCitationMarkers(response.Text, citations)
-
-		for _, citation := range citations {
-			if segments, ok := citation["segments"].([]map[string]interface{}); ok {
-				for _, segment := range segments {
-					allSourcesGathered = append(allSourcesGathered, SourceSegment{
-						Value:    segment["value"].(string),
-						ShortURL: segment["short_url"].(string),
-						LinkID:   fmt.Sprintf("%d", idx),
-					})
-				}
+	parallelism := n.config.MaxParallelQueries
+	if parallelism <= 0 {
+		parallelism = defaultMaxParallelQueries
+	}
+	results := make([]queryResult, len(queriesToProcess))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for range min(parallelism, len(queriesToProcess)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for idx := range jobs {
+				results[idx] = n.researchQuery(ctx, record, prompts, policy, state.Citations, idx, queriesToProcess[idx].Query)
 			}
+		}()
+	}
+	for idx := range queriesToProcess {
+		if overBudget() {
+			break
+		}
+		jobs <- idx
+	}
+	close(jobs)
+	wg.Wait()
+
+	// Merge in query order so the run does not depend on which search
+	// finished first.
+	var firstErr error
+	for idx, result := range results {
+		query := queriesToProcess[idx]
+		if !result.executed {
+			state.SkippedQueries = append(state.SkippedQueries, SkippedQuery{Query: query.Query, Reason: budgetSkipReason})
+			continue
+		}
+		state.ExecutedQueries = append(state.ExecutedQueries, query.Query)
+		state.SourceDecisions = append(state.SourceDecisions, result.decisions...)
+		switch {
+		case result.err != nil:
+			state.FailedQueries = append(state.FailedQueries, FailedQuery{Query: query.Query, Error: result.err.Error()})
+			if firstErr == nil {
+				firstErr = result.err
+			}
+		case result.skipped != "":
+			state.SkippedQueries = append(state.SkippedQueries, SkippedQuery{Query: query.Query, Reason: result.skipped})
+		default:
+			allSourcesGathered = append(allSourcesGathered, result.sources...)
+			allWebResearchResult = append(allWebResearchResult, result.text)
+			state.SearchQueries = append(state.SearchQueries, query) // Tracking all queries that were actually executed
 		}
-		allWebResearchResult = append(allWebResearchResult, modified_text)
-		state.SearchQueries = append(state.SearchQueries, query) // Tracking all queries that were actually executed
+	}
+	if firstErr != nil && len(allWebResearchResult) == 0 {
+		return nil, "", firstErr
 	}
 
 	state.SourcesGathered = append(state.SourcesGathered, allSourcesGathered...)
@@ -199,23 +284,172 @@ func (n *Nodes) WebResearchNode(ctx context.Context, state *OverallState) (*Over
 	return state, "reflection", nil
 }
 
+// budgetSkipReason is recorded for queries WebResearchNode never started
+// because the run went over budget.
+const budgetSkipReason = "run budget exceeded"
+
+// queryResult is the outcome of one query in WebResearchNode. A query is
+// either summarised, skipped for the reason given, or failed with err.
+type queryResult struct {
+	executed  bool
+	text      string
+	sources   []SourceSegment
+	skipped   string
+	decisions []SourceDecision
+	err       error
+}
+
+// researchQuery searches for query and summarises what it finds. It runs
+// concurrently with other queries, so it reports model usage through record
+// instead of touching state.
+func (n *Nodes) researchQuery(ctx context.Context, record func(string, *UsageMetadata, bool), prompts *PromptSet, policy *DomainPolicy, citations *CitationRegistry, idx int, query string) queryResult {
+	formatted_prompt, err := prompts.WebSearcher.Render(WebSearcherPromptData{
+		CurrentDate:   GetCurrentDate(),
+		ResearchTopic: query,
+	})
+	if err != nil {
+		return queryResult{executed: true, err: err}
+	}
+
+	response, err := n.search.Search(ctx, SearchRequest{
+		Query:      query,
+		Prompt:     formatted_prompt,
+		MaxResults: n.config.MaxSearchResults,
+		ID:         idx,
+		Citations:  citations,
+		Policy:     policy,
+	})
+	result := queryResult{executed: true}
+	var blocked *ErrSafetyBlocked
+	if errors.As(err, &blocked) {
+		result.skipped = blocked.Error()
+		return result
+	}
+	if err != nil {
+		result.err = fmt.Errorf("error during web search for query '%s': %w", query, err)
+		return result
+	}
+	if response.Model != "" {
+		record(response.Model, response.Usage, response.Cached)
+	}
+
+	if policy != nil && len(response.Results) > 0 {
+		response.Results, result.decisions = policy.Filter(query, response.Results)
+		if len(response.Results) == 0 {
+			result.skipped = "all sources excluded by domain policy"
+			return result
+		}
+	}
+
+	fetched := n.fetchPages(ctx, response.Results)
+
+	modified_text, sources := response.Summary, response.Sources
+	if modified_text != "" && fetched > 0 {
+		page_text, page_sources, err := n.summarizeResults(ctx, record, prompts, citations, query, response.Results, idx)
+		if err == nil {
+			modified_text += "\n\n" + page_text
+			sources = append(sources, page_sources...)
+		} else if !errors.As(err, &blocked) {
+			result.err = fmt.Errorf("failed to summarize pages for query '%s': %w", query, err)
+			return result
+		}
+	}
+	if modified_text == "" {
+		if len(response.Results) == 0 {
+			result.skipped = "no search results"
+			return result
+		}
+		modified_text, sources, err = n.summarizeResults(ctx, record, prompts, citations, query, response.Results, idx)
+		if errors.As(err, &blocked) {
+			result.skipped = blocked.Error()
+			return result
+		}
+		if err != nil {
+			result.err = fmt.Errorf("failed to summarize results for query '%s': %w", query, err)
+			return result
+		}
+	}
+	result.text, result.sources = modified_text, sources
+	return result
+}
+
+// fetchPages fills in Content for up to MaxFetchPages of the top results and
+// returns how many were fetched. Pages that cannot be fetched, including those
+// disallowed by robots.txt, are left as they are.
+func (n *Nodes) fetchPages(ctx context.Context, results []SearchResult) int {
+	if n.fetcher == nil {
+		return 0
+	}
+	limit := n.config.MaxFetchPages
+	if limit <= 0 {
+		limit = defaultMaxFetchPages
+	}
+	fetched := 0
+	for i := range results {
+		if i >= limit {
+			break
+		}
+		page, err := n.fetcher.Fetch(ctx, results[i].URL)
+		if err != nil || page.Text == "" {
+			continue
+		}
+		results[i].Content = page.Text
+		if results[i].Title == "" {
+			results[i].Title = page.Title
+		}
+		fetched++
+	}
+	return fetched
+}
+
+// summarizeResults writes a cited summary of results from a search provider
+// that returns plain results rather than its own summary.
+func (n *Nodes) summarizeResults(ctx context.Context, record func(string, *UsageMetadata, bool), prompts *PromptSet, citations *CitationRegistry, query string, results []SearchResult, id int) (string, []SourceSegment, error) {
+	formatted_results, sources := formatSearchResults(results, citations, id)
+	formatted_prompt, err := prompts.SearchSummary.Render(SearchSummaryPromptData{
+		CurrentDate:   GetCurrentDate(),
+		ResearchTopic: query,
+		SearchResults: formatted_results,
+	})
+	if err != nil {
+		return "", nil, err
+	}
+
+	llm := n.webSearchLLM.WithModels(n.config.queryGeneratorChain()).WithTools()
+	response, err := llm.Generate(ctx, formatted_prompt)
+	if err != nil {
+		return "", nil, err
+	}
+	record(response.Model, response.UsageMetadata, response.Cached)
+	return response.Text, sources, nil
+}
+
 func (n *Nodes) ReflectionNode(ctx context.Context, state *OverallState) (*OverallState, string, error) {
 	state.ResearchLoopCount++
 
-	llm := n.reasoningLLM
-	if state.ReasoningModel != "" {
-		llm.Model = state.ReasoningModel // Directly set the model if specified in state
-	} else {
-		llm.Model = n.config.ReasoningModel // Otherwise, use the default from config
+	llm := n.reasoningLLM.WithModels(n.config.reflectionChain(state.ReasoningModel)).WithThinking(n.config.ReflectionThinking)
+
+	if state.BudgetExceeded {
+		return state, "evaluate_research", nil
 	}
 
-	formatted_prompt := fmt.Sprintf(ReflectionInstructions,
-		GetResearchTopic(state.Messages), GetCurrentDate(), strings.Join(state.WebResearchResults, "\n\n---\n\n"))
+	prompts, err := n.promptSet(state)
+	if err != nil {
+		return nil, "", err
+	}
+	formatted_prompt, err := prompts.Reflection.Render(ReflectionPromptData{
+		ResearchTopic: GetLatestQuestion(state.Messages),
+		Summaries:     strings.Join(state.WebResearchResults, "\n\n---\n\n"),
+	})
+	if err != nil {
+		return nil, "", err
+	}
 
-	result, err := llm.WithStructuredOutput(Reflection{}).Invoke(formatted_prompt)
+	result, err := llm.WithStructuredOutput(Reflection{}).InvokeMessages(ctx, withInstructions(formatted_prompt, state.Messages))
 	if err != nil {
 		return nil, "", fmt.Errorf("failed to perform reflection: %w", err)
 	}
+	n.recordUsage(ctx, state, result.Model, result.UsageMetadata, result.Cached)
 
 	var reflectionResult Reflection
 	err = json.Unmarshal([]byte(result.Content), &reflectionResult)
@@ -226,7 +460,6 @@ func (n *Nodes) ReflectionNode(ctx context.Context, state *OverallState) (*Overa
 	state.IsSufficient = reflectionResult.IsSufficient
 	state.KnowledgeGap = reflectionResult.KnowledgeGap
 	state.FollowUpQueries = reflectionResult.FollowUpQueries
-	state.ResearchLoopCount = state.ResearchLoopCount   // Already incremented
 	state.NumberOfRanQueries = len(state.SearchQueries) // Refers to the queries ran in WebResearchNode
 
 	return state, "evaluate_research", nil
@@ -238,50 +471,103 @@ func (n *Nodes) EvaluateResearchNode(ctx context.Context, state *OverallState) (
 		max_research_loops = state.MaxResearchLoops
 	}
 
-	if state.IsSufficient || state.ResearchLoopCount >= max_research_loops {
+	if state.IsSufficient || state.ResearchLoopCount >= max_research_loops || state.BudgetExceeded {
 		return state, "finalize_answer", nil
 	} else {
-		state.SearchQueries = []Query{}
+		var candidates []Query
 		for _, q := range state.FollowUpQueries {
-			state.SearchQueries = append(state.SearchQueries, Query{Query: q})
+			candidates = append(candidates, Query{Query: q})
 		}
 		state.FollowUpQueries = []string{} // Clear follow up queries once processed
+
+		queries, skipped, err := n.dedupQueries(ctx, state.ExecutedQueries, candidates)
+		if err != nil {
+			return nil, "", err
+		}
+		state.SkippedQueries = append(state.SkippedQueries, skipped...)
+		if len(queries) == 0 {
+			return state, "finalize_answer", nil
+		}
+		state.SearchQueries = queries
 		return state, "web_research", nil
 	}
 }
 
 func (n *Nodes) FinalizeAnswerNode(ctx context.Context, state *OverallState) (*OverallState, string, error) {
-	llm := n.reasoningLLM
-	if state.ReasoningModel != "" {
-		llm.Model = state.ReasoningModel // Directly set the model if specified in state
+	llm := n.reasoningLLM.WithModels(n.config.answerChain(state.ReasoningModel)).WithThinking(n.config.AnswerThinking)
+	llm.Temperature = 0
+
+	prompts, err := n.promptSet(state)
+	if err != nil {
+		return nil, "", err
+	}
+	formatted_prompt, err := prompts.Answer.Render(AnswerPromptData{
+		CurrentDate:   GetCurrentDate(),
+		ResearchTopic: GetLatestQuestion(state.Messages),
+		Summaries:     strings.Join(state.WebResearchResults, "\n---\n\n"),
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	var result AIMessage
+	if n.tools != nil {
+		produced, err := llm.InvokeWithTools(ctx, withInstructions(formatted_prompt, state.Messages), n.tools, n.config.MaxToolSteps)
+		for _, message := range produced {
+			if aiMessage, ok := message.(AIMessage); ok {
+				n.recordUsage(ctx, state, aiMessage.Model, aiMessage.UsageMetadata, aiMessage.Cached)
+			}
+		}
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to finalize answer: %w", err)
+		}
+		// Tool calls and their results stay in the thread ahead of the answer.
+		state.Messages = append(state.Messages, produced[:len(produced)-1]...)
+		result = produced[len(produced)-1].(AIMessage)
 	} else {
-		llm.Model = n.config.ReasoningModel // Otherwise, use the default from config
+		result, err = llm.InvokeMessages(ctx, withInstructions(formatted_prompt, state.Messages))
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to finalize answer: %w", err)
+		}
+		n.recordUsage(ctx, state, result.Model, result.UsageMetadata, result.Cached)
 	}
-	llm.Temperature = 0
 
-	formatted_prompt := fmt.Sprintf(AnswerInstructions,
-		GetResearchTopic(state.Messages), strings.Join(state.WebResearchResults, "\n---\n\n"), GetCurrentDate())
+	state.AnswerDraft = result.Content
+	if err := n.renderAnswer(state, &result); err != nil {
+		return nil, "", err
+	}
+	state.Messages = append(state.Messages, result)
 
-	result, err := llm.Invoke(formatted_prompt)
+	return state, "__END__", nil
+}
+
+// renderAnswer renders state.AnswerDraft into answer with the configured
+// citation format and narrows SourcesGathered and the bibliography to the
+// sources it cites.
+func (n *Nodes) renderAnswer(state *OverallState, answer *AIMessage) error {
+	format, err := MarkerFormatByName(n.config.CitationFormat)
 	if err != nil {
-		return nil, "", fmt.Errorf("failed to finalize answer: %w", err)
+		return err
 	}
-
-	uniqueSourcesMap := make(map[string]SourceSegment)
+	gathered := make(map[string]SourceSegment)
 	for _, source := range state.SourcesGathered {
-		if strings.Contains(result.Content, source.ShortURL) {
-			result.Content = strings.ReplaceAll(result.Content, source.ShortURL, source.Value)
-			uniqueSourcesMap[source.Value] = source
+		if _, ok := gathered[source.ShortURL]; !ok {
+			gathered[source.ShortURL] = source
 		}
 	}
+	content, cited := state.Citations.Render(state.AnswerDraft, format)
+	answer.Content = content
 
 	var uniqueSources []SourceSegment
-	for _, source := range uniqueSourcesMap {
-		uniqueSources = append(uniqueSources, source)
+	for _, source := range cited {
+		segment, ok := gathered[source.ShortURL]
+		if !ok {
+			continue
+		}
+		segment.Value, segment.Title = source.URL, source.Title
+		uniqueSources = append(uniqueSources, segment)
 	}
-
-	state.Messages = []Message{AIMessage{Content: result.Content}}
 	state.SourcesGathered = uniqueSources
-
-	return state, "__END__", nil
+	state.Bibliography = NewBibliography(cited, GetCurrentDate())
+	return nil
 }
@@ -6,10 +6,10 @@ const (
 Instructions:
 - Always prefer a single search query, only add another query if the original question requests multiple aspects or elements and one query is not enough.
 - Each query should focus on one specific aspect of the original question.
-- Don't produce more than %d queries.
+- Don't produce more than {{.NumberQueries}} queries.
 - Queries should be diverse, if the topic is broad, generate more than 1 query.
 - Don't generate multiple similar queries, 1 is enough.
-- Query should ensure that the most current information is gathered. The current date is %s.
+- Query should ensure that the most current information is gathered. The current date is {{.CurrentDate}}.
 
 Format: 
 - Format your response as a JSON object with ALL three of these exact keys:
@@ -24,22 +24,35 @@ Topic: What revenue grew more last year apple stock or the number of people buyi
     "query": ["Apple total revenue growth fiscal year 2024", "iPhone unit sales growth fiscal year 2024", "Apple stock price growth fiscal year 2024"]
 }` + "\n```\n" + `
 
-Context: %s`
+Context: {{.ResearchTopic}}`
 
-	WebSearcherInstructions = `Conduct targeted Google Searches to gather the most recent, credible information on "%s" and synthesize it into a verifiable text artifact.
+	WebSearcherInstructions = `Conduct targeted Google Searches to gather the most recent, credible information on "{{.ResearchTopic}}" and synthesize it into a verifiable text artifact.
 
 Instructions:
-- Query should ensure that the most current information is gathered. The current date is %s.
+- Query should ensure that the most current information is gathered. The current date is {{.CurrentDate}}.
 - Conduct multiple, diverse searches to gather comprehensive information.
 - Consolidate key findings while meticulously tracking the source(s) for each specific piece of information.
 - The output should be a well-written summary or report based on your search findings. 
 - Only include the information found in the search results, don't make up any information.
 
 Research Topic:
-%s
+{{.ResearchTopic}}
 `
 
-	ReflectionInstructions = `You are an expert research assistant analyzing summaries about "%s".
+	SearchSummaryInstructions = `Synthesize the search results below into a verifiable text artifact about "{{.ResearchTopic}}".
+
+Instructions:
+- The current date is {{.CurrentDate}}.
+- Consolidate key findings while meticulously tracking the source(s) for each specific piece of information.
+- Cite every fact with a markdown link to its source, using the source title as the label and the URL exactly as listed, e.g. [Title](URL).
+- The output should be a well-written summary or report based on the search results.
+- Only include the information found in the search results, don't make up any information.
+
+Search Results:
+{{.SearchResults}}
+`
+
+	ReflectionInstructions = `You are an expert research assistant analyzing summaries about "{{.ResearchTopic}}".
 
 Instructions:
 - Identify knowledge gaps or areas that need deeper exploration and generate a follow-up query. (1 or multiple).
@@ -66,13 +79,13 @@ Example:
 Reflect carefully on the Summaries to identify knowledge gaps and produce a follow-up query. Then, produce your output following this JSON format:
 
 Summaries:
-%s
+{{.Summaries}}
 `
 
 	AnswerInstructions = `Generate a high-quality answer to the user's question based on the provided summaries.
 
 Instructions:
-- The current date is %s.
+- The current date is {{.CurrentDate}}.
 - You are the final step of a multi-step research process, don't mention that you are the final step. 
 - You have access to all the information gathered from the previous steps.
 - You have access to the user's question.
@@ -80,8 +93,65 @@ Instructions:
 - you MUST include all the citations from the summaries in the answer correctly.
 
 User Context:
-- %s
+- {{.ResearchTopic}}
 
 Summaries:
-%s`
+{{.Summaries}}`
+
+	ClaimVerifierInstructions = `You are a meticulous fact checker verifying an answer about "{{.ResearchTopic}}" against the research it was written from.
+
+Instructions:
+- The current date is {{.CurrentDate}}.
+- Check each numbered claim below against the research only, not against your own knowledge.
+- A claim is "supported" when the research states it, "contradicted" when the research states otherwise and "unsupported" when the research does not address it.
+- Sources are identified by the number at the end of their citation URL, e.g. https://vertexaisearch.cloud.google.com/id/3 is source 3.
+- For claims that are not supported, write a revision that keeps only what the research supports, without citation links. Leave the revision empty if nothing can be kept.
+
+Format:
+- Format your response as a JSON object with a "claims" key holding one object per claim with these exact keys:
+   - "claim": The claim's number
+   - "verdict": "supported", "unsupported" or "contradicted"
+   - "source_ids": The IDs of the sources that support or contradict the claim
+   - "reason": Brief explanation of the verdict
+   - "revision": The rewritten claim, for claims that are not supported
+
+Claims:
+{{.Claims}}
+Research:
+{{.Summaries}}`
 )
+
+type QueryWriterPromptData struct {
+	CurrentDate   string
+	ResearchTopic string
+	NumberQueries int
+}
+
+type WebSearcherPromptData struct {
+	CurrentDate   string
+	ResearchTopic string
+}
+
+type SearchSummaryPromptData struct {
+	CurrentDate   string
+	ResearchTopic string
+	SearchResults string
+}
+
+type ReflectionPromptData struct {
+	ResearchTopic string
+	Summaries     string
+}
+
+type AnswerPromptData struct {
+	CurrentDate   string
+	ResearchTopic string
+	Summaries     string
+}
+
+type ClaimVerifierPromptData struct {
+	CurrentDate   string
+	ResearchTopic string
+	Claims        string
+	Summaries     string
+}
@@ -0,0 +1,213 @@
+package agent
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+)
+
+const (
+	// DefaultPromptSet names the built-in prompts in prompts.go.
+	DefaultPromptSet = "default"
+
+	promptExt         = ".tmpl"
+	promptVersionFile = "VERSION"
+)
+
+// PromptSet is one complete set of prompts for the research workflow.
+type PromptSet struct {
+	Name    string
+	Version string
+
+	QueryWriter   *Prompt
+	WebSearcher   *Prompt
+	SearchSummary *Prompt
+	Reflection    *Prompt
+	Answer        *Prompt
+	ClaimVerifier *Prompt
+}
+
+// promptSpecs lists each prompt by file name with its built-in text and data
+// type.
+var promptSpecs = []struct {
+	name string
+	text string
+	data any
+	set  func(*PromptSet, *Prompt)
+}{
+	{"query_writer", QueryWriterInstructions, QueryWriterPromptData{}, func(s *PromptSet, p *Prompt) { s.QueryWriter = p }},
+	{"web_searcher", WebSearcherInstructions, WebSearcherPromptData{}, func(s *PromptSet, p *Prompt) { s.WebSearcher = p }},
+	{"search_summary", SearchSummaryInstructions, SearchSummaryPromptData{}, func(s *PromptSet, p *Prompt) { s.SearchSummary = p }},
+	{"reflection", ReflectionInstructions, ReflectionPromptData{}, func(s *PromptSet, p *Prompt) { s.Reflection = p }},
+	{"answer", AnswerInstructions, AnswerPromptData{}, func(s *PromptSet, p *Prompt) { s.Answer = p }},
+	{"claim_verifier", ClaimVerifierInstructions, ClaimVerifierPromptData{}, func(s *PromptSet, p *Prompt) { s.ClaimVerifier = p }},
+}
+
+// builtinPrompts is parsed and validated when the package loads.
+var builtinPrompts = mustBuildPromptSet(DefaultPromptSet, nil, "")
+
+// buildPromptSet parses a prompt set. Prompts missing from texts use the
+// built-in text. When version is empty it is derived from the prompt texts.
+func buildPromptSet(name string, texts map[string]string, version string) (*PromptSet, error) {
+	set := &PromptSet{Name: name}
+	hash := sha256.New()
+	var errs []error
+	for _, spec := range promptSpecs {
+		text, ok := texts[spec.name]
+		if !ok {
+			text = spec.text
+		}
+		fmt.Fprintf(hash, "%s\x00%s\x00", spec.name, text)
+
+		prompt, err := ParsePrompt(spec.name, text, spec.data)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		spec.set(set, prompt)
+	}
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("prompt set %s: %w", name, errors.Join(errs...))
+	}
+
+	set.Version = version
+	if set.Version == "" {
+		set.Version = name + "-" + hex.EncodeToString(hash.Sum(nil))[:12]
+	}
+	return set, nil
+}
+
+func mustBuildPromptSet(name string, texts map[string]string, version string) *PromptSet {
+	set, err := buildPromptSet(name, texts, version)
+	if err != nil {
+		panic(err)
+	}
+	return set
+}
+
+// PromptRegistry holds the prompt sets a run can select by name.
+type PromptRegistry struct {
+	sets map[string]*PromptSet
+}
+
+// NewPromptRegistry returns a registry holding only the built-in prompts.
+func NewPromptRegistry() *PromptRegistry {
+	return &PromptRegistry{sets: map[string]*PromptSet{DefaultPromptSet: builtinPrompts}}
+}
+
+// LoadPromptRegistry reads prompt overrides from fsys, which can be
+// os.DirFS or an embed.FS. Template files (query_writer.tmpl,
+// web_searcher.tmpl, search_summary.tmpl, reflection.tmpl, answer.tmpl,
+// claim_verifier.tmpl) at the root override the default set, and each
+// subdirectory defines a set named after it. Prompts a set does not override
+// fall back to the built-in ones. An optional VERSION file pins the set's
+// version; otherwise it is a hash of the prompt texts.
+func LoadPromptRegistry(fsys fs.FS) (*PromptRegistry, error) {
+	registry := NewPromptRegistry()
+
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read prompt directory: %w", err)
+	}
+	dirs := []string{"."}
+	for _, entry := range entries {
+		if entry.IsDir() && !strings.HasPrefix(entry.Name(), ".") {
+			dirs = append(dirs, entry.Name())
+		}
+	}
+
+	for _, dir := range dirs {
+		name := dir
+		if dir == "." {
+			name = DefaultPromptSet
+		}
+		texts, version, err := readPromptDir(fsys, dir)
+		if err != nil {
+			return nil, err
+		}
+		if dir == "." && len(texts) == 0 && version == "" {
+			continue
+		}
+		set, err := buildPromptSet(name, texts, version)
+		if err != nil {
+			return nil, err
+		}
+		registry.Register(set)
+	}
+	return registry, nil
+}
+
+func readPromptDir(fsys fs.FS, dir string) (map[string]string, string, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read prompt directory %s: %w", dir, err)
+	}
+
+	texts := make(map[string]string)
+	version := ""
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		file := entry.Name()
+		name := strings.TrimSuffix(file, promptExt)
+		switch {
+		case file == promptVersionFile:
+		case path.Ext(file) != promptExt:
+			continue
+		case !isPromptName(name):
+			return nil, "", fmt.Errorf("unknown prompt %s in %s", file, dir)
+		}
+
+		data, err := fs.ReadFile(fsys, path.Join(dir, file))
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to read %s: %w", path.Join(dir, file), err)
+		}
+		if file == promptVersionFile {
+			version = strings.TrimSpace(string(data))
+		} else {
+			texts[name] = string(data)
+		}
+	}
+	return texts, version, nil
+}
+
+func isPromptName(name string) bool {
+	for _, spec := range promptSpecs {
+		if spec.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Register adds set under set.Name, replacing any set with that name.
+func (r *PromptRegistry) Register(set *PromptSet) {
+	r.sets[set.Name] = set
+}
+
+// Get returns the named set. An empty name selects DefaultPromptSet.
+func (r *PromptRegistry) Get(name string) (*PromptSet, error) {
+	if name == "" {
+		name = DefaultPromptSet
+	}
+	set, ok := r.sets[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown prompt set %q (available: %s)", name, strings.Join(r.Names(), ", "))
+	}
+	return set, nil
+}
+
+func (r *PromptRegistry) Names() []string {
+	names := make([]string, 0, len(r.sets))
+	for name := range r.sets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,114 @@
+package agent
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+const testAnswerTemplate = "Answer {{.ResearchTopic}} as of {{.CurrentDate}} from {{.Summaries}}"
+
+func renderAnswer(t *testing.T, set *PromptSet) string {
+	t.Helper()
+	text, err := set.Answer.Render(AnswerPromptData{CurrentDate: "today", ResearchTopic: "tides", Summaries: "notes"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return text
+}
+
+func TestLoadPromptRegistry(t *testing.T) {
+	fsys := fstest.MapFS{
+		"answer.tmpl":             {Data: []byte(testAnswerTemplate)},
+		"README.md":               {Data: []byte("not a prompt")},
+		"concise/VERSION":         {Data: []byte(" v2\n")},
+		"concise/reflection.tmpl": {Data: []byte("Reflect on {{.ResearchTopic}} given {{.Summaries}}")},
+		"hashed/answer.tmpl":      {Data: []byte(testAnswerTemplate)},
+		".git/answer.tmpl":        {Data: []byte("ignored")},
+	}
+	registry, err := LoadPromptRegistry(fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := registry.Names(), []string{"concise", "default", "hashed"}; !slices.Equal(got, want) {
+		t.Fatalf("Names() = %v, want %v", got, want)
+	}
+
+	def, err := registry.Get("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if def.Name != DefaultPromptSet {
+		t.Errorf("Get(\"\") returned set %q", def.Name)
+	}
+	if got := renderAnswer(t, def); got != "Answer tides as of today from notes" {
+		t.Errorf("root override not applied: %q", got)
+	}
+	if def.Version == builtinPrompts.Version {
+		t.Errorf("overridden default set kept the built-in version %q", def.Version)
+	}
+
+	concise, err := registry.Get("concise")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if concise.Version != "v2" {
+		t.Errorf("concise version = %q, want v2 from VERSION", concise.Version)
+	}
+	if got, want := renderAnswer(t, concise), renderAnswer(t, builtinPrompts); got != want {
+		t.Errorf("concise answer did not fall back to the built-in prompt:\n%s", got)
+	}
+
+	hashed, err := registry.Get("hashed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !regexp.MustCompile(`^hashed-[0-9a-f]{12}$`).MatchString(hashed.Version) {
+		t.Errorf("hashed version = %q, want a content hash", hashed.Version)
+	}
+	// The hash covers the texts only, so it matches the default set's hash.
+	if strings.TrimPrefix(hashed.Version, "hashed-") != strings.TrimPrefix(def.Version, "default-") {
+		t.Errorf("versions %q and %q differ for the same texts", hashed.Version, def.Version)
+	}
+
+	if _, err := registry.Get("missing"); err == nil || !strings.Contains(err.Error(), "available: concise, default, hashed") {
+		t.Errorf("Get(missing) error = %v", err)
+	}
+}
+
+func TestLoadPromptRegistryWithoutOverrides(t *testing.T) {
+	registry, err := LoadPromptRegistry(fstest.MapFS{"only/VERSION": {Data: []byte("1")}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	def, err := registry.Get(DefaultPromptSet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if def != builtinPrompts {
+		t.Error("an empty root replaced the built-in default set")
+	}
+}
+
+func TestLoadPromptRegistryErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		fsys    fstest.MapFS
+		wantErr string
+	}{
+		{"unknown prompt", fstest.MapFS{"summary.tmpl": {Data: []byte("x")}}, "unknown prompt summary.tmpl in ."},
+		{"unknown prompt in set", fstest.MapFS{"short/answers.tmpl": {Data: []byte("x")}}, "unknown prompt answers.tmpl in short"},
+		{"unused variable", fstest.MapFS{"short/answer.tmpl": {Data: []byte("{{.ResearchTopic}}")}}, "prompt set short: prompt answer: unused variables CurrentDate, Summaries"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := LoadPromptRegistry(tt.fsys)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,271 @@
+package agent
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// DefaultRateLimitKey selects the limit applied to models without their own
+// entry in Configuration.RateLimits.
+const DefaultRateLimitKey = "*"
+
+const rateLimitWindow = time.Minute
+
+// RateLimit caps calls to one model. Zero fields are unlimited.
+type RateLimit struct {
+	RequestsPerMinute int
+	TokensPerMinute   int
+	MaxInFlight       int
+}
+
+// RateLimiter hands out call slots per model. Callers for the same model are
+// admitted strictly in arrival order.
+type RateLimiter struct {
+	mu     sync.Mutex
+	limits map[string]RateLimit
+	models map[string]*modelLimiter
+}
+
+func NewRateLimiter(limits map[string]RateLimit) *RateLimiter {
+	return &RateLimiter{
+		limits: limits,
+		models: make(map[string]*modelLimiter),
+	}
+}
+
+// Acquire blocks until a call to model with the estimated token count may
+// start, or ctx is done. The returned release must be called once the call
+// finishes, with the actual token count when known (0 keeps the estimate).
+func (l *RateLimiter) Acquire(ctx context.Context, model string, tokens int) (func(usedTokens int), error) {
+	m := l.forModel(model)
+	if m == nil {
+		return func(int) {}, nil
+	}
+	return m.acquire(ctx, tokens)
+}
+
+func (l *RateLimiter) forModel(model string) *modelLimiter {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if m, ok := l.models[model]; ok {
+		return m
+	}
+	limit, ok := l.limits[model]
+	if !ok {
+		limit, ok = l.limits[DefaultRateLimitKey]
+	}
+	if !ok || limit == (RateLimit{}) {
+		l.models[model] = nil
+		return nil
+	}
+	m := &modelLimiter{limit: limit}
+	l.models[model] = m
+	return m
+}
+
+type limiterWaiter struct {
+	tokens int
+	wake   chan struct{}
+}
+
+type admittedCall struct {
+	at     time.Time
+	tokens int
+}
+
+type modelLimiter struct {
+	limit RateLimit
+
+	mu       sync.Mutex
+	queue    []*limiterWaiter
+	inFlight int
+	recent   []*admittedCall
+}
+
+func (m *modelLimiter) acquire(ctx context.Context, tokens int) (func(int), error) {
+	w := &limiterWaiter{tokens: tokens, wake: make(chan struct{}, 1)}
+
+	m.mu.Lock()
+	m.queue = append(m.queue, w)
+	for {
+		var wait time.Duration = -1
+		if m.queue[0] == w {
+			var ok bool
+			if wait, ok = m.admitWait(w.tokens, time.Now()); ok {
+				call := &admittedCall{at: time.Now(), tokens: w.tokens}
+				m.recent = append(m.recent, call)
+				m.inFlight++
+				m.queue = m.queue[1:]
+				m.wakeHead()
+				m.mu.Unlock()
+				return m.releaser(call), nil
+			}
+		}
+		m.mu.Unlock()
+
+		var timer *time.Timer
+		var timeout <-chan time.Time
+		if wait >= 0 {
+			timer = time.NewTimer(wait)
+			timeout = timer.C
+		}
+		select {
+		case <-ctx.Done():
+			m.mu.Lock()
+			m.remove(w)
+			m.wakeHead()
+			m.mu.Unlock()
+			return nil, ctx.Err()
+		case <-w.wake:
+		case <-timeout:
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+		m.mu.Lock()
+	}
+}
+
+// admitWait reports whether a call may start now and, if it may not because
+// of the per-minute windows, how long until it could. A negative wait means
+// the caller must wait for an in-flight call to finish.
+func (m *modelLimiter) admitWait(tokens int, now time.Time) (time.Duration, bool) {
+	cutoff := now.Add(-rateLimitWindow)
+	for len(m.recent) > 0 && !m.recent[0].at.After(cutoff) {
+		m.recent = m.recent[1:]
+	}
+
+	if m.limit.MaxInFlight > 0 && m.inFlight >= m.limit.MaxInFlight {
+		return -1, false
+	}
+	if m.limit.RequestsPerMinute > 0 && len(m.recent) >= m.limit.RequestsPerMinute {
+		return m.recent[len(m.recent)-m.limit.RequestsPerMinute].at.Sub(cutoff), false
+	}
+	if m.limit.TokensPerMinute > 0 {
+		used := 0
+		for _, call := range m.recent {
+			used += call.tokens
+		}
+		// Wait for the oldest calls to expire until this one fits. A single
+		// call larger than the whole budget is let through once the window
+		// is empty.
+		if used > 0 && used+tokens > m.limit.TokensPerMinute {
+			for _, call := range m.recent {
+				used -= call.tokens
+				if used == 0 || used+tokens <= m.limit.TokensPerMinute {
+					return call.at.Sub(cutoff), false
+				}
+			}
+		}
+	}
+	return 0, true
+}
+
+func (m *modelLimiter) releaser(call *admittedCall) func(int) {
+	var once sync.Once
+	return func(usedTokens int) {
+		once.Do(func() {
+			m.mu.Lock()
+			defer m.mu.Unlock()
+			if usedTokens > 0 {
+				call.tokens = usedTokens
+			}
+			m.inFlight--
+			m.wakeHead()
+		})
+	}
+}
+
+func (m *modelLimiter) remove(w *limiterWaiter) {
+	for i, queued := range m.queue {
+		if queued == w {
+			m.queue = append(m.queue[:i], m.queue[i+1:]...)
+			return
+		}
+	}
+}
+
+func (m *modelLimiter) wakeHead() {
+	if len(m.queue) == 0 {
+		return
+	}
+	select {
+	case m.queue[0].wake <- struct{}{}:
+	default:
+	}
+}
+
+// RateLimitedGenerator gates every call to Next through Limiter.
+type RateLimitedGenerator struct {
+	Next    ContentGenerator
+	Limiter *RateLimiter
+}
+
+func (g *RateLimitedGenerator) GenerateContent(ctx context.Context, model string, req *GenerateContentRequest) (*GeminiResponse, error) {
+	release, err := g.Limiter.Acquire(ctx, model, estimateTokens(req))
+	if err != nil {
+		return nil, err
+	}
+	response, err := g.Next.GenerateContent(ctx, model, req)
+	if err == nil && response.UsageMetadata != nil {
+		release(response.UsageMetadata.TotalTokenCount)
+	} else {
+		release(0)
+	}
+	return response, err
+}
+
+// RateLimitedSearchProvider gates every search through Limiter under Key,
+// the provider's name.
+type RateLimitedSearchProvider struct {
+	Next    SearchProvider
+	Limiter *RateLimiter
+	Key     string
+}
+
+func (p *RateLimitedSearchProvider) Search(ctx context.Context, req SearchRequest) (*SearchResponse, error) {
+	release, err := p.Limiter.Acquire(ctx, p.Key, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer release(0)
+	return p.Next.Search(ctx, req)
+}
+
+// RateLimitedEmbedder gates every call to Next through Limiter under Key,
+// the embedding model's name.
+type RateLimitedEmbedder struct {
+	Next    Embedder
+	Limiter *RateLimiter
+	Key     string
+}
+
+func (e *RateLimitedEmbedder) Embed(ctx context.Context, texts []string) ([][]float64, error) {
+	chars := 0
+	for _, text := range texts {
+		chars += len(text)
+	}
+	release, err := e.Limiter.Acquire(ctx, e.Key, chars/4+1)
+	if err != nil {
+		return nil, err
+	}
+	defer release(0)
+	return e.Next.Embed(ctx, texts)
+}
+
+// estimateTokens approximates the prompt size at four characters per token.
+func estimateTokens(req *GenerateContentRequest) int {
+	chars := 0
+	contents := req.Contents
+	if req.SystemInstruction != nil {
+		contents = append([]Content{*req.SystemInstruction}, contents...)
+	}
+	for _, content := range contents {
+		for _, part := range content.Parts {
+			chars += len(part.Text)
+		}
+	}
+	return chars/4 + 1
+}
@@ -0,0 +1,107 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRateLimiterMaxInFlight(t *testing.T) {
+	limiter := NewRateLimiter(map[string]RateLimit{"m": {MaxInFlight: 1}})
+
+	release, err := limiter.Acquire(context.Background(), "m", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := limiter.Acquire(ctx, "m", 10); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("second call admitted while the first is in flight: %v", err)
+	}
+
+	release(0)
+	second, err := limiter.Acquire(context.Background(), "m", 10)
+	if err != nil {
+		t.Fatalf("call not admitted after release: %v", err)
+	}
+	second(0)
+}
+
+func TestRateLimiterRequestsPerMinute(t *testing.T) {
+	limiter := NewRateLimiter(map[string]RateLimit{DefaultRateLimitKey: {RequestsPerMinute: 2}})
+
+	for i := 0; i < 2; i++ {
+		release, err := limiter.Acquire(context.Background(), "m", 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		release(0)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := limiter.Acquire(ctx, "m", 0); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("third request within the window admitted: %v", err)
+	}
+}
+
+func TestRateLimiterUnlimitedModel(t *testing.T) {
+	limiter := NewRateLimiter(map[string]RateLimit{"other": {MaxInFlight: 1}})
+	for i := 0; i < 3; i++ {
+		if _, err := limiter.Acquire(context.Background(), "m", 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+type searchFunc func(ctx context.Context, req SearchRequest) (*SearchResponse, error)
+
+func (f searchFunc) Search(ctx context.Context, req SearchRequest) (*SearchResponse, error) {
+	return f(ctx, req)
+}
+
+func TestRateLimitedSearchProviderUsesItsKey(t *testing.T) {
+	limiter := NewRateLimiter(map[string]RateLimit{SearchProviderBrave: {MaxInFlight: 1}})
+	calls := 0
+	provider := &RateLimitedSearchProvider{
+		Next: searchFunc(func(ctx context.Context, req SearchRequest) (*SearchResponse, error) {
+			calls++
+			return &SearchResponse{}, nil
+		}),
+		Limiter: limiter,
+		Key:     SearchProviderBrave,
+	}
+
+	if _, err := provider.Search(context.Background(), SearchRequest{Query: "q"}); err != nil {
+		t.Fatal(err)
+	}
+
+	release, err := limiter.Acquire(context.Background(), SearchProviderBrave, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer release(0)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := provider.Search(ctx, SearchRequest{Query: "q"}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("search ran while the provider's slot was taken: %v", err)
+	}
+	if calls != 1 {
+		t.Errorf("expected 1 search, got %d", calls)
+	}
+}
+
+func TestRateLimitedEmbedderUsesItsKey(t *testing.T) {
+	limiter := NewRateLimiter(map[string]RateLimit{DefaultEmbeddingModel: {TokensPerMinute: 10}})
+	embedder := &RateLimitedEmbedder{Next: &HashingEmbedder{}, Limiter: limiter, Key: DefaultEmbeddingModel}
+
+	vectors, err := embedder.Embed(context.Background(), []string{"short"})
+	if err != nil || len(vectors) != 1 {
+		t.Fatalf("Embed() = %d vectors, %v", len(vectors), err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := embedder.Embed(ctx, []string{string(make([]byte, 40))}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("embedding over the token budget admitted: %v", err)
+	}
+}
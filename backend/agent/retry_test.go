@@ -0,0 +1,100 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestRetryRetriesTransientErrors(t *testing.T) {
+	attempts := 0
+	result, err := retry(context.Background(), RetryPolicy{MaxRetries: 3, BaseDelay: time.Millisecond}, func() (string, error) {
+		attempts++
+		if attempts < 3 {
+			return "", &APIError{StatusCode: http.StatusServiceUnavailable}
+		}
+		return "ok", nil
+	})
+	if err != nil || result != "ok" {
+		t.Fatalf("retry() = %q, %v", result, err)
+	}
+	if attempts != 3 {
+		t.Errorf("expected 3 attempts, got %d", attempts)
+	}
+}
+
+func TestRetryGivesUp(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		attempts int
+	}{
+		{"client error", &APIError{StatusCode: http.StatusBadRequest}, 1},
+		{"retries spent", &APIError{StatusCode: http.StatusBadGateway}, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			attempts := 0
+			_, err := retry(context.Background(), RetryPolicy{MaxRetries: 2, BaseDelay: time.Millisecond}, func() (int, error) {
+				attempts++
+				return 0, tt.err
+			})
+			if !errors.Is(err, tt.err) {
+				t.Errorf("expected %v, got %v", tt.err, err)
+			}
+			if attempts != tt.attempts {
+				t.Errorf("expected %d attempts, got %d", tt.attempts, attempts)
+			}
+		})
+	}
+}
+
+func TestRetryStopsWhenContextIsDone(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	attempts := 0
+	_, err := retry(ctx, RetryPolicy{MaxRetries: 5, BaseDelay: time.Hour, MaxDelay: time.Hour}, func() (int, error) {
+		attempts++
+		cancel()
+		return 0, &APIError{StatusCode: http.StatusInternalServerError}
+	})
+	if !errors.Is(err, context.Canceled) || attempts != 1 {
+		t.Fatalf("retry() = %v after %d attempts", err, attempts)
+	}
+}
+
+func TestIsRetryable(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{&ErrRateLimited{&APIError{StatusCode: http.StatusTooManyRequests}}, true},
+		{&APIError{StatusCode: http.StatusInternalServerError}, true},
+		{&APIError{StatusCode: http.StatusBadGateway}, true},
+		{&APIError{StatusCode: http.StatusServiceUnavailable}, true},
+		{&APIError{StatusCode: http.StatusGatewayTimeout}, true},
+		{&APIError{StatusCode: http.StatusBadRequest}, false},
+		{&APIError{StatusCode: http.StatusNotFound}, false},
+		{fmt.Errorf("read body: %w", io.ErrUnexpectedEOF), true},
+		{context.Canceled, false},
+		{context.DeadlineExceeded, false},
+		{errors.New("bad JSON"), false},
+	}
+	for _, tt := range tests {
+		if got := isRetryable(tt.err); got != tt.want {
+			t.Errorf("isRetryable(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestBackoffIsCapped(t *testing.T) {
+	policy := RetryPolicy{BaseDelay: time.Second, MaxDelay: 5 * time.Second}
+	for attempt := 0; attempt < 70; attempt++ {
+		if delay := policy.backoff(attempt); delay < 0 || delay > policy.MaxDelay {
+			t.Fatalf("backoff(%d) = %v, outside [0, %v]", attempt, delay, policy.MaxDelay)
+		}
+	}
+}
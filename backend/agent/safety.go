@@ -0,0 +1,72 @@
+package agent
+
+import "strings"
+
+const (
+	FinishReasonStop              = "STOP"
+	FinishReasonMaxTokens         = "MAX_TOKENS"
+	FinishReasonSafety            = "SAFETY"
+	FinishReasonRecitation        = "RECITATION"
+	FinishReasonBlocklist         = "BLOCKLIST"
+	FinishReasonProhibitedContent = "PROHIBITED_CONTENT"
+	FinishReasonSPII              = "SPII"
+)
+
+// HarmCategories are the categories a SafetyThreshold applies to.
+var HarmCategories = []string{
+	"HARM_CATEGORY_HARASSMENT",
+	"HARM_CATEGORY_HATE_SPEECH",
+	"HARM_CATEGORY_SEXUALLY_EXPLICIT",
+	"HARM_CATEGORY_DANGEROUS_CONTENT",
+}
+
+type SafetySetting struct {
+	Category  string `json:"category"`
+	Threshold string `json:"threshold"`
+}
+
+type SafetyRating struct {
+	Category    string `json:"category"`
+	Probability string `json:"probability"`
+	Blocked     bool   `json:"blocked,omitempty"`
+}
+
+// SafetySettingsForThreshold applies one threshold, e.g. "BLOCK_ONLY_HIGH",
+// to every harm category.
+func SafetySettingsForThreshold(threshold string) []SafetySetting {
+	if threshold == "" {
+		return nil
+	}
+	settings := make([]SafetySetting, 0, len(HarmCategories))
+	for _, category := range HarmCategories {
+		settings = append(settings, SafetySetting{Category: category, Threshold: threshold})
+	}
+	return settings
+}
+
+// checkResponse turns a response with nothing usable in it into an
+// *ErrSafetyBlocked: a blocked prompt, no candidates at all, or a candidate
+// that stopped for a policy reason without producing any output.
+func checkResponse(response *GeminiResponse) error {
+	if response.PromptFeedback != nil && response.PromptFeedback.BlockReason != "" {
+		return &ErrSafetyBlocked{
+			BlockReason:   response.PromptFeedback.BlockReason,
+			SafetyRatings: response.PromptFeedback.SafetyRatings,
+		}
+	}
+	if len(response.Candidates) == 0 {
+		return &ErrSafetyBlocked{BlockReason: "NO_CANDIDATES"}
+	}
+
+	candidate := response.Candidates[0]
+	switch candidate.FinishReason {
+	case FinishReasonStop, FinishReasonMaxTokens, "":
+		return nil
+	}
+	for _, part := range candidate.Content.Parts {
+		if strings.TrimSpace(part.Text) != "" || part.FunctionCall != nil {
+			return nil
+		}
+	}
+	return &ErrSafetyBlocked{FinishReason: candidate.FinishReason, SafetyRatings: candidate.SafetyRatings}
+}
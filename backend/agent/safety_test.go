@@ -0,0 +1,77 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGenerateReportsSafetyBlocks(t *testing.T) {
+	tests := []struct {
+		name             string
+		body             string
+		wantBlockReason  string
+		wantFinishReason string
+	}{
+		{
+			name:            "blocked prompt",
+			body:            `{"promptFeedback": {"blockReason": "SAFETY", "safetyRatings": [{"category": "HARM_CATEGORY_HARASSMENT", "probability": "HIGH", "blocked": true}]}}`,
+			wantBlockReason: "SAFETY",
+		},
+		{
+			name:            "no candidates",
+			body:            `{"candidates": []}`,
+			wantBlockReason: "NO_CANDIDATES",
+		},
+		{
+			name:             "candidate stopped for safety",
+			body:             `{"candidates": [{"content": {"role": "model", "parts": [{"text": " "}]}, "finishReason": "SAFETY"}]}`,
+			wantFinishReason: FinishReasonSafety,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+
+			llm := &ChatGoogleGenerativeAI{
+				Model:  "gemini-2.0-flash",
+				Client: &GeminiClient{APIKey: "test", BaseURL: server.URL, HTTPClient: server.Client()},
+			}
+			_, err := llm.Generate(context.Background(), "hello")
+
+			var blocked *ErrSafetyBlocked
+			if !errors.As(err, &blocked) {
+				t.Fatalf("Generate() error = %v, want *ErrSafetyBlocked", err)
+			}
+			if blocked.BlockReason != tt.wantBlockReason || blocked.FinishReason != tt.wantFinishReason {
+				t.Errorf("got block reason %q, finish reason %q; want %q, %q",
+					blocked.BlockReason, blocked.FinishReason, tt.wantBlockReason, tt.wantFinishReason)
+			}
+		})
+	}
+}
+
+func TestGenerateAllowsStoppedCandidates(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"candidates": [{"content": {"role": "model", "parts": [{"text": "partial"}]}, "finishReason": "RECITATION"}]}`))
+	}))
+	defer server.Close()
+
+	llm := &ChatGoogleGenerativeAI{
+		Model:  "gemini-2.0-flash",
+		Client: &GeminiClient{APIKey: "test", BaseURL: server.URL, HTTPClient: server.Client()},
+	}
+	response, err := llm.Generate(context.Background(), "hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.Text != "partial" {
+		t.Errorf("Text = %q, want partial", response.Text)
+	}
+}
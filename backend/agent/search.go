@@ -0,0 +1,396 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	SearchProviderGemini  = "gemini"
+	SearchProviderSearxNG = "searxng"
+	SearchProviderBrave   = "brave"
+	SearchProviderTavily  = "tavily"
+
+	defaultBraveBaseURL  = "https://api.search.brave.com/res/v1"
+	defaultTavilyBaseURL = "https://api.tavily.com"
+	defaultMaxResults    = 5
+
+	defaultMaxParallelQueries = 4
+)
+
+// SearchResult is one hit from a SearchProvider. PublishedDate is zero when
+// the provider does not report one. Content holds the page's main text when
+// it was fetched.
+type SearchResult struct {
+	URL           string    `json:"url"`
+	Title         string    `json:"title"`
+	Snippet       string    `json:"snippet,omitempty"`
+	PublishedDate time.Time `json:"published_date,omitzero"`
+	Content       string    `json:"content,omitempty"`
+}
+
+// SearchRequest is one query for a SearchProvider. Prompt is the rendered
+// web searcher prompt for providers that write their own summary; ID numbers
+// the query within the research loop. Providers that cite sources take their
+// short URLs from Citations, or from a registry of their own when it is nil.
+type SearchRequest struct {
+	Query      string
+	Prompt     string
+	MaxResults int
+	ID         int
+	Citations  *CitationRegistry
+
+	// Policy, when set, keeps providers that write their own summary from
+	// citing sources it rejects.
+	Policy *DomainPolicy
+}
+
+// SearchResponse holds the results of a search. Providers that synthesise
+// an answer themselves, such as Gemini grounding, also fill Summary and
+// Sources, and Model, Usage and Cached for the model call they made.
+type SearchResponse struct {
+	Results []SearchResult
+	Summary string
+	Sources []SourceSegment
+	Model   string
+	Usage   *UsageMetadata
+	Cached  bool
+}
+
+type SearchProvider interface {
+	Search(ctx context.Context, req SearchRequest) (*SearchResponse, error)
+}
+
+// NewSearchProvider returns the provider named by config.SearchProvider.
+// llm, with the query generator model chain, is used for Gemini grounding.
+func NewSearchProvider(config *Configuration, llm *ChatGoogleGenerativeAI) (SearchProvider, error) {
+	switch config.SearchProvider {
+	case "", SearchProviderGemini:
+		return &GeminiSearchProvider{LLM: llm.WithModels(config.queryGeneratorChain())}, nil
+	case SearchProviderSearxNG:
+		if config.SearchBaseURL == "" {
+			return nil, fmt.Errorf("search provider %s requires a base URL", config.SearchProvider)
+		}
+		return &SearxNGProvider{BaseURL: config.SearchBaseURL, HTTPClient: config.HTTPClient, MaxRetries: 2}, nil
+	case SearchProviderBrave:
+		return &BraveSearchProvider{BaseURL: config.SearchBaseURL, APIKey: config.SearchAPIKey, HTTPClient: config.HTTPClient, MaxRetries: 2}, nil
+	case SearchProviderTavily:
+		return &TavilySearchProvider{BaseURL: config.SearchBaseURL, APIKey: config.SearchAPIKey, HTTPClient: config.HTTPClient, MaxRetries: 2}, nil
+	case SearchProviderLocal:
+		if config.CorpusDir == "" {
+			return nil, fmt.Errorf("search provider %s requires a corpus directory", config.SearchProvider)
+		}
+		return NewLocalSearchProvider(config.CorpusDir, config.CorpusIndexPath)
+	}
+	return nil, fmt.Errorf("unknown search provider %q", config.SearchProvider)
+}
+
+// GeminiSearchProvider runs the prompt with Google Search grounding and
+// returns the grounded summary with citation markers already inserted.
+type GeminiSearchProvider struct {
+	LLM *ChatGoogleGenerativeAI
+}
+
+func (p *GeminiSearchProvider) Search(ctx context.Context, req SearchRequest) (*SearchResponse, error) {
+	prompt := req.Prompt
+	if prompt == "" {
+		prompt = req.Query
+	}
+	response, err := p.LLM.Generate(ctx, prompt)
+	if err != nil {
+		return nil, err
+	}
+
+	text, grounding := response.Text, response.Candidates[0].GroundingMetadata
+	if req.Policy != nil {
+		text, grounding = req.Policy.FilterGrounding(text, grounding)
+	}
+	registry := req.Citations
+	if registry == nil {
+		registry = NewCitationRegistry()
+	}
+	resolved_urls := ResolveURLs(grounding.GroundingChunks, registry)
+	citations := GetCitations(&LLMResponse{
+		Candidates: []struct {
+			GroundingMetadata GroundingMetadata `json:"groundingMetadata"`
+		}{
+			{GroundingMetadata: grounding},
+		},
+		Text: text,
+	}, resolved_urls)
+
+	result := &SearchResponse{
+		Summary: InsertCitationMarkers(text, citations, MarkdownMarkers{}),
+		Model:   response.Model,
+		Usage:   response.UsageMetadata,
+		Cached:  response.Cached,
+	}
+	// Results lists every chunk, rejected ones included, so the domain
+	// policy's decisions are recorded for all of them.
+	for _, chunk := range response.Candidates[0].GroundingMetadata.GroundingChunks {
+		result.Results = append(result.Results, SearchResult{URL: chunk.Web.URI, Title: chunk.Web.Title})
+	}
+	for _, citation := range citations {
+		for _, segment := range citation.Segments {
+			source, _ := registry.Lookup(segment.ShortURL)
+			result.Sources = append(result.Sources, SourceSegment{
+				Value:    source.URL,
+				ShortURL: source.ShortURL,
+				LinkID:   strconv.Itoa(req.ID),
+				Title:    source.Title,
+			})
+		}
+	}
+	return result, nil
+}
+
+// SearxNGProvider queries a SearxNG instance's JSON API. The instance must
+// have the json format enabled.
+type SearxNGProvider struct {
+	BaseURL    string
+	HTTPClient *http.Client
+	MaxRetries int
+}
+
+func (p *SearxNGProvider) Search(ctx context.Context, req SearchRequest) (*SearchResponse, error) {
+	params := url.Values{"q": {req.Query}, "format": {"json"}}
+	endpoint := strings.TrimRight(p.BaseURL, "/") + "/search?" + params.Encode()
+
+	var body struct {
+		Results []struct {
+			URL           string `json:"url"`
+			Title         string `json:"title"`
+			Content       string `json:"content"`
+			PublishedDate string `json:"publishedDate"`
+		} `json:"results"`
+	}
+	err := fetchSearchJSON(ctx, p.HTTPClient, p.MaxRetries, &body, func() (*http.Request, error) {
+		return http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("searxng search failed: %w", err)
+	}
+
+	response := &SearchResponse{}
+	for _, r := range body.Results {
+		response.Results = append(response.Results, SearchResult{
+			URL:           r.URL,
+			Title:         r.Title,
+			Snippet:       r.Content,
+			PublishedDate: parsePublishedDate(r.PublishedDate),
+		})
+	}
+	response.Results = limitResults(response.Results, req.MaxResults)
+	return response, nil
+}
+
+// BraveSearchProvider queries the Brave Search web API.
+type BraveSearchProvider struct {
+	BaseURL    string
+	APIKey     string
+	HTTPClient *http.Client
+	MaxRetries int
+}
+
+func (p *BraveSearchProvider) Search(ctx context.Context, req SearchRequest) (*SearchResponse, error) {
+	baseURL := p.BaseURL
+	if baseURL == "" {
+		baseURL = defaultBraveBaseURL
+	}
+	params := url.Values{"q": {req.Query}, "count": {strconv.Itoa(maxResults(req.MaxResults))}}
+	endpoint := strings.TrimRight(baseURL, "/") + "/web/search?" + params.Encode()
+
+	var body struct {
+		Web struct {
+			Results []struct {
+				URL         string `json:"url"`
+				Title       string `json:"title"`
+				Description string `json:"description"`
+				PageAge     string `json:"page_age"`
+			} `json:"results"`
+		} `json:"web"`
+	}
+	err := fetchSearchJSON(ctx, p.HTTPClient, p.MaxRetries, &body, func() (*http.Request, error) {
+		httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+		if err != nil {
+			return nil, err
+		}
+		httpReq.Header.Set("Accept", "application/json")
+		httpReq.Header.Set("X-Subscription-Token", p.APIKey)
+		return httpReq, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("brave search failed: %w", err)
+	}
+
+	response := &SearchResponse{}
+	for _, r := range body.Web.Results {
+		response.Results = append(response.Results, SearchResult{
+			URL:           r.URL,
+			Title:         r.Title,
+			Snippet:       r.Description,
+			PublishedDate: parsePublishedDate(r.PageAge),
+		})
+	}
+	response.Results = limitResults(response.Results, req.MaxResults)
+	return response, nil
+}
+
+// TavilySearchProvider queries a Tavily-style JSON search API: a POST to
+// /search with the query in the body and results under "results".
+type TavilySearchProvider struct {
+	BaseURL    string
+	APIKey     string
+	HTTPClient *http.Client
+	MaxRetries int
+}
+
+func (p *TavilySearchProvider) Search(ctx context.Context, req SearchRequest) (*SearchResponse, error) {
+	baseURL := p.BaseURL
+	if baseURL == "" {
+		baseURL = defaultTavilyBaseURL
+	}
+	endpoint := strings.TrimRight(baseURL, "/") + "/search"
+	payload, err := json.Marshal(map[string]any{
+		"query":       req.Query,
+		"max_results": maxResults(req.MaxResults),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	var body struct {
+		Results []struct {
+			URL           string `json:"url"`
+			Title         string `json:"title"`
+			Content       string `json:"content"`
+			PublishedDate string `json:"published_date"`
+		} `json:"results"`
+	}
+	err = fetchSearchJSON(ctx, p.HTTPClient, p.MaxRetries, &body, func() (*http.Request, error) {
+		httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(payload))
+		if err != nil {
+			return nil, err
+		}
+		httpReq.Header.Set("Content-Type", "application/json")
+		httpReq.Header.Set("Authorization", "Bearer "+p.APIKey)
+		return httpReq, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("tavily search failed: %w", err)
+	}
+
+	response := &SearchResponse{}
+	for _, r := range body.Results {
+		response.Results = append(response.Results, SearchResult{
+			URL:           r.URL,
+			Title:         r.Title,
+			Snippet:       r.Content,
+			PublishedDate: parsePublishedDate(r.PublishedDate),
+		})
+	}
+	response.Results = limitResults(response.Results, req.MaxResults)
+	return response, nil
+}
+
+// fetchSearchJSON sends the request built by newRequest, retrying transient
+// failures, and decodes the JSON response into out. newRequest is called
+// once per attempt so request bodies can be re-read.
+func fetchSearchJSON(ctx context.Context, httpClient *http.Client, maxRetries int, out any, newRequest func() (*http.Request, error)) error {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	body, err := retry(ctx, RetryPolicy{MaxRetries: maxRetries}, func() ([]byte, error) {
+		req, err := newRequest()
+		if err != nil {
+			return nil, fmt.Errorf("failed to build request: %w", err)
+		}
+		resp, err := httpClient.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			return nil, NewAPIError(resp.StatusCode, resp.Header, body)
+		}
+		return body, nil
+	})
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(body, out); err != nil {
+		return fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+	return nil
+}
+
+func maxResults(n int) int {
+	if n <= 0 {
+		return defaultMaxResults
+	}
+	return n
+}
+
+func limitResults(results []SearchResult, n int) []SearchResult {
+	if n = maxResults(n); len(results) > n {
+		return results[:n]
+	}
+	return results
+}
+
+var publishedDateLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+	time.RFC1123,
+	time.RFC1123Z,
+}
+
+// parsePublishedDate accepts the date formats search APIs commonly return
+// and yields the zero time for anything else.
+func parsePublishedDate(value string) time.Time {
+	for _, layout := range publishedDateLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// formatSearchResults lists results for the search summary prompt, each
+// with its short URL from registry, and returns the matching sources.
+func formatSearchResults(results []SearchResult, registry *CitationRegistry, id int) (string, []SourceSegment) {
+	var sb strings.Builder
+	var sources []SourceSegment
+	for i, result := range results {
+		source := registry.Register(result.URL, result.Title)
+		shortURL := source.ShortURL
+		fmt.Fprintf(&sb, "[%d] %s\nURL: %s\n", i+1, result.Title, shortURL)
+		if !result.PublishedDate.IsZero() {
+			fmt.Fprintf(&sb, "Published: %s\n", result.PublishedDate.Format("January 2, 2006"))
+		}
+		if result.Snippet != "" {
+			fmt.Fprintf(&sb, "%s\n", result.Snippet)
+		}
+		if result.Content != "" {
+			fmt.Fprintf(&sb, "Page content:\n%s\n", truncateRunes(result.Content, defaultMaxPageChars))
+		}
+		sb.WriteString("\n")
+		sources = append(sources, SourceSegment{Value: source.URL, ShortURL: shortURL, LinkID: strconv.Itoa(id), Title: source.Title})
+	}
+	return strings.TrimSpace(sb.String()), sources
+}
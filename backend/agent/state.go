@@ -1,5 +1,7 @@
 package agent
 
+import "encoding/json"
+
 type Message interface {
 	GetContent() string
 	Type() string
@@ -18,7 +20,19 @@ func (m HumanMessage) Type() string {
 }
 
 type AIMessage struct {
-	Content string
+	Content       string
+	Thoughts      string
+	ToolCalls     []ToolCall
+	Model         string
+	FinishReason  string
+	UsageMetadata *UsageMetadata
+	Cached        bool
+}
+
+// ToolCall is a function call requested by the model.
+type ToolCall struct {
+	Name string
+	Args map[string]any
 }
 
 func (m AIMessage) GetContent() string {
@@ -29,6 +43,33 @@ func (m AIMessage) Type() string {
 	return "ai"
 }
 
+type SystemMessage struct {
+	Content string
+}
+
+func (m SystemMessage) GetContent() string {
+	return m.Content
+}
+
+func (m SystemMessage) Type() string {
+	return "system"
+}
+
+// ToolMessage carries the result of a tool call back to the model. Name is
+// the tool that produced it.
+type ToolMessage struct {
+	Name    string
+	Content string
+}
+
+func (m ToolMessage) GetContent() string {
+	return m.Content
+}
+
+func (m ToolMessage) Type() string {
+	return "tool"
+}
+
 type Query struct {
 	Query     string `json:"query"`
 	Rationale string `json:"rationale"`
@@ -38,6 +79,7 @@ type SourceSegment struct {
 	Value    string `json:"value"`
 	ShortURL string `json:"short_url"`
 	LinkID   string `json:"link_id"`
+	Title    string `json:"title,omitempty"`
 }
 
 type OverallState struct {
@@ -45,6 +87,7 @@ type OverallState struct {
 	SearchQueries           []Query
 	WebResearchResults      []string
 	SourcesGathered         []SourceSegment
+	Citations               *CitationRegistry
 	InitialSearchQueryCount int
 	MaxResearchLoops        int
 	ResearchLoopCount       int
@@ -54,6 +97,54 @@ type OverallState struct {
 	KnowledgeGap       string
 	FollowUpQueries    []string
 	NumberOfRanQueries int
+
+	Usage          RunUsage
+	BudgetExceeded bool
+
+	// ExecutedQueries is every query searched so far in the run, across
+	// research loops.
+	ExecutedQueries []string
+	SkippedQueries  []SkippedQuery
+	FailedQueries   []FailedQuery
+
+	// SourceDecisions records what the domain policy did with each search
+	// result. It is empty when no policy is configured.
+	SourceDecisions []SourceDecision
+
+	// AnswerDraft is the final answer as the model wrote it, citing short
+	// URLs, before citation markers are rendered.
+	AnswerDraft string
+
+	// Bibliography lists the sources cited by the final answer, numbered
+	// like its citation markers.
+	Bibliography *Bibliography
+
+	// ClaimVerdicts holds the verifier's verdict on each claim in the final
+	// answer when VerifyClaims is set.
+	ClaimVerdicts []ClaimVerdict
+
+	// PromptSet and PromptVersion identify the prompts that produced the
+	// answer.
+	PromptSet     string
+	PromptVersion string
+}
+
+// SkippedQuery is a query that was not searched or produced no results:
+// Gemini blocked it, the search came back empty, it repeated an earlier
+// query, or the run went over budget before it was searched. Repeats record
+// the closest earlier query and their similarity.
+type SkippedQuery struct {
+	Query        string
+	Reason       string
+	ClosestMatch string
+	Similarity   float64
+}
+
+// FailedQuery is a search or summary that failed. Other queries in the same
+// loop still contribute their results.
+type FailedQuery struct {
+	Query string
+	Error string
 }
 
 type SearchQueryList struct {
@@ -65,3 +156,20 @@ type Reflection struct {
 	KnowledgeGap    string   `json:"knowledge_gap"`
 	FollowUpQueries []string `json:"follow_up_queries"`
 }
+
+// UnmarshalJSON accepts either a bare query string, as the query writer prompt
+// asks the model for, or a {"query", "rationale"} object.
+func (q *Query) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err == nil {
+		*q = Query{Query: text}
+		return nil
+	}
+	type query Query
+	var parsed query
+	if err := json.Unmarshal(data, &parsed); err != nil {
+		return err
+	}
+	*q = Query(parsed)
+	return nil
+}
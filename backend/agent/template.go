@@ -0,0 +1,151 @@
+package agent
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+	"text/template"
+	"text/template/parse"
+)
+
+// Prompt is a text/template bound to the struct type it is rendered with.
+// Every field the template references must exist on the struct and every
+// struct field must be referenced, so a prompt and its call site cannot
+// drift apart silently.
+type Prompt struct {
+	Name     string
+	tmpl     *template.Template
+	dataType reflect.Type
+}
+
+// ParsePrompt parses text as a template named name and checks its variables
+// against the exported fields of data, which must be a struct value.
+func ParsePrompt(name, text string, data any) (*Prompt, error) {
+	dataType := reflect.TypeOf(data)
+	if dataType == nil || dataType.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("prompt %s: data must be a struct, got %T", name, data)
+	}
+
+	tmpl, err := template.New(name).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse prompt %s: %w", name, err)
+	}
+
+	used := make(map[string]bool)
+	for _, t := range tmpl.Templates() {
+		if t.Tree != nil {
+			collectFields(t.Tree.Root, used, true)
+		}
+	}
+
+	var declared []string
+	for i := 0; i < dataType.NumField(); i++ {
+		if field := dataType.Field(i); field.IsExported() {
+			declared = append(declared, field.Name)
+		}
+	}
+
+	var missing, unused []string
+	for field := range used {
+		if !slices.Contains(declared, field) {
+			missing = append(missing, field)
+		}
+	}
+	for _, field := range declared {
+		if !used[field] {
+			unused = append(unused, field)
+		}
+	}
+	sort.Strings(missing)
+
+	var problems []string
+	if len(missing) > 0 {
+		problems = append(problems, fmt.Sprintf("undefined variables %s", strings.Join(missing, ", ")))
+	}
+	if len(unused) > 0 {
+		problems = append(problems, fmt.Sprintf("unused variables %s", strings.Join(unused, ", ")))
+	}
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("prompt %s: %s", name, strings.Join(problems, "; "))
+	}
+
+	return &Prompt{Name: name, tmpl: tmpl, dataType: dataType}, nil
+}
+
+func mustParsePrompt(name, text string, data any) *Prompt {
+	prompt, err := ParsePrompt(name, text, data)
+	if err != nil {
+		panic(err)
+	}
+	return prompt
+}
+
+// Render executes the prompt with data, which must be of the type the
+// prompt was parsed with.
+func (p *Prompt) Render(data any) (string, error) {
+	if reflect.TypeOf(data) != p.dataType {
+		return "", fmt.Errorf("prompt %s: expected %s data, got %T", p.Name, p.dataType.Name(), data)
+	}
+	var sb strings.Builder
+	if err := p.tmpl.Execute(&sb, data); err != nil {
+		return "", fmt.Errorf("failed to render prompt %s: %w", p.Name, err)
+	}
+	return sb.String(), nil
+}
+
+// collectFields records the top-level field names referenced under node, as
+// .Foo where dot is the template data or as $.Foo anywhere. Range and with
+// blocks rebind dot, so inside them .Foo names a field of the new dot and is
+// not recorded. topLevel reports whether dot is the template data at node.
+func collectFields(node parse.Node, used map[string]bool, topLevel bool) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, child := range n.Nodes {
+			collectFields(child, used, topLevel)
+		}
+	case *parse.ActionNode:
+		collectFields(n.Pipe, used, topLevel)
+	case *parse.PipeNode:
+		if n == nil {
+			return
+		}
+		for _, cmd := range n.Cmds {
+			collectFields(cmd, used, topLevel)
+		}
+	case *parse.CommandNode:
+		for _, arg := range n.Args {
+			collectFields(arg, used, topLevel)
+		}
+	case *parse.FieldNode:
+		if topLevel {
+			used[n.Ident[0]] = true
+		}
+	case *parse.VariableNode:
+		if len(n.Ident) > 1 && n.Ident[0] == "$" {
+			used[n.Ident[1]] = true
+		}
+	case *parse.ChainNode:
+		collectFields(n.Node, used, topLevel)
+	case *parse.IfNode:
+		collectBranch(&n.BranchNode, used, topLevel, topLevel)
+	case *parse.RangeNode:
+		collectBranch(&n.BranchNode, used, topLevel, false)
+	case *parse.WithNode:
+		collectBranch(&n.BranchNode, used, topLevel, false)
+	case *parse.TemplateNode:
+		collectFields(n.Pipe, used, topLevel)
+	}
+}
+
+// collectBranch walks an if, range or with block. Its pipeline and else list
+// see the enclosing dot; bodyTopLevel tells whether its body does too.
+func collectBranch(n *parse.BranchNode, used map[string]bool, topLevel, bodyTopLevel bool) {
+	collectFields(n.Pipe, used, topLevel)
+	collectFields(n.List, used, bodyTopLevel)
+	collectFields(n.ElseList, used, topLevel)
+}
@@ -0,0 +1,62 @@
+package agent
+
+import (
+	"strings"
+	"testing"
+)
+
+type templateItem struct {
+	Name string
+}
+
+type templateData struct {
+	Topic string
+	Items []templateItem
+}
+
+func TestParsePromptChecksVariables(t *testing.T) {
+	tests := []struct {
+		name    string
+		text    string
+		wantErr string
+	}{
+		{"all used", "{{.Topic}}: {{range .Items}}{{.Name}}{{end}}", ""},
+		{"with rebinds dot", "{{with .Items}}{{len .}}{{end}}{{.Topic}}", ""},
+		{"root variable inside range", "{{range .Items}}{{.Name}} on {{$.Topic}}{{end}}", ""},
+		{"range else sees the data", "{{range .Items}}{{.Name}}{{else}}nothing on {{.Topic}}{{end}}", ""},
+		{"if keeps dot", "{{if .Items}}{{.Topic}}{{end}}", ""},
+		{"defined template", `{{define "topic"}}{{.Topic}}{{end}}{{template "topic" .}}{{.Items}}`, ""},
+		{"missing variable", "{{.Topic}} {{.Items}} {{.Question}}", "undefined variables Question"},
+		{"unused variable", "{{.Topic}}", "unused variables Items"},
+		{"element field is not a data field", "{{range .Items}}{{.Topic}}{{end}}", "unused variables Topic"},
+		{"both", "{{.Items}} {{.Date}}", "undefined variables Date; unused variables Topic"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParsePrompt("test", tt.text, templateData{})
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Errorf("unexpected error: %v", err)
+			case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+				t.Errorf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestPromptRender(t *testing.T) {
+	prompt, err := ParsePrompt("test", "{{.Topic}}:{{range .Items}} {{.Name}}{{end}}", templateData{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := prompt.Render(templateData{Topic: "cities", Items: []templateItem{{"Paris"}, {"Lyon"}}})
+	if err != nil || got != "cities: Paris Lyon" {
+		t.Errorf("Render() = %q, %v", got, err)
+	}
+	if _, err := prompt.Render(struct{ Topic string }{"cities"}); err == nil {
+		t.Error("Render() accepted data of another type")
+	}
+	if _, err := ParsePrompt("test", "{{.Topic}}", "not a struct"); err == nil {
+		t.Error("ParsePrompt() accepted non-struct data")
+	}
+}
@@ -0,0 +1,486 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"golang.org/x/net/html"
+)
+
+const defaultMaxToolSteps = 5
+
+// Tool is a function the model may call. Parameters is a JSON schema object
+// describing the arguments passed to Call.
+type Tool interface {
+	Name() string
+	Description() string
+	Parameters() map[string]any
+	Call(ctx context.Context, args map[string]any) (string, error)
+}
+
+type ToolRegistry struct {
+	tools map[string]Tool
+	order []string
+}
+
+func NewToolRegistry(tools ...Tool) *ToolRegistry {
+	r := &ToolRegistry{tools: make(map[string]Tool)}
+	for _, tool := range tools {
+		r.Register(tool)
+	}
+	return r
+}
+
+func (r *ToolRegistry) Register(tool Tool) {
+	if _, exists := r.tools[tool.Name()]; !exists {
+		r.order = append(r.order, tool.Name())
+	}
+	r.tools[tool.Name()] = tool
+}
+
+func (r *ToolRegistry) Get(name string) (Tool, bool) {
+	tool, ok := r.tools[name]
+	return tool, ok
+}
+
+// Declarations returns the registry as a Gemini tools entry.
+func (r *ToolRegistry) Declarations() map[string]any {
+	declarations := make([]map[string]any, 0, len(r.order))
+	for _, name := range r.order {
+		tool := r.tools[name]
+		declarations = append(declarations, map[string]any{
+			"name":        tool.Name(),
+			"description": tool.Description(),
+			"parameters":  tool.Parameters(),
+		})
+	}
+	return map[string]any{"functionDeclarations": declarations}
+}
+
+// BuiltinTools returns the tools enabled by name in Configuration.Tools.
+func BuiltinTools(names []string) (*ToolRegistry, error) {
+	builtins := map[string]Tool{
+		"calculator":   CalculatorTool{},
+		"current_date": CurrentDateTool{},
+		"fetch_url":    &FetchURLTool{},
+	}
+	registry := NewToolRegistry()
+	for _, name := range names {
+		tool, ok := builtins[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown tool %q", name)
+		}
+		registry.Register(tool)
+	}
+	return registry, nil
+}
+
+// InvokeWithTools runs the function-calling loop: the model is called with the
+// registry's declarations, any tool calls it requests are executed and their
+// results sent back, until it answers without calling a tool. It returns the
+// messages produced along the way; the last one is the final answer. Tool
+// errors are reported back to the model rather than failing the loop.
+func (llm *ChatGoogleGenerativeAI) InvokeWithTools(ctx context.Context, messages []Message, registry *ToolRegistry, maxSteps int) ([]Message, error) {
+	if maxSteps <= 0 {
+		maxSteps = defaultMaxToolSteps
+	}
+	toolLLM := llm.WithTools(append(append([]map[string]any{}, llm.Tools...), registry.Declarations())...)
+
+	var produced []Message
+	for step := 0; step < maxSteps; step++ {
+		conversation := append(append([]Message{}, messages...), produced...)
+		result, err := toolLLM.InvokeMessages(ctx, conversation)
+		if err != nil {
+			return produced, err
+		}
+		produced = append(produced, result)
+		if len(result.ToolCalls) == 0 {
+			return produced, nil
+		}
+
+		for _, call := range result.ToolCalls {
+			produced = append(produced, ToolMessage{Name: call.Name, Content: callTool(ctx, registry, call)})
+		}
+	}
+	return produced, fmt.Errorf("model did not finish within %d tool steps", maxSteps)
+}
+
+func callTool(ctx context.Context, registry *ToolRegistry, call ToolCall) string {
+	tool, ok := registry.Get(call.Name)
+	if !ok {
+		return fmt.Sprintf("error: unknown tool %q", call.Name)
+	}
+	result, err := tool.Call(ctx, call.Args)
+	if err != nil {
+		return "error: " + err.Error()
+	}
+	return result
+}
+
+// CalculatorTool evaluates arithmetic expressions. It supports + - * / %,
+// ^ or ** for powers, parentheses, pi, e and common math functions.
+type CalculatorTool struct{}
+
+func (CalculatorTool) Name() string { return "calculator" }
+
+func (CalculatorTool) Description() string {
+	return "Evaluate an arithmetic expression, e.g. \"(12.5 * 4) / 3\" or \"sqrt(2) ^ 2\"."
+}
+
+func (CalculatorTool) Parameters() map[string]any {
+	return map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"expression": map[string]any{"type": "string", "description": "The expression to evaluate."},
+		},
+		"required": []string{"expression"},
+	}
+}
+
+func (CalculatorTool) Call(ctx context.Context, args map[string]any) (string, error) {
+	expression, _ := args["expression"].(string)
+	if strings.TrimSpace(expression) == "" {
+		return "", fmt.Errorf("expression is required")
+	}
+	p := &calcParser{input: expression}
+	value, err := p.parseExpr()
+	if err != nil {
+		return "", err
+	}
+	if p.skipSpace(); p.pos < len(p.input) {
+		return "", fmt.Errorf("unexpected %q at position %d", p.input[p.pos], p.pos)
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64), nil
+}
+
+var calculatorFuncs = map[string]func(float64) float64{
+	"sqrt":  math.Sqrt,
+	"abs":   math.Abs,
+	"ln":    math.Log,
+	"log":   math.Log10,
+	"exp":   math.Exp,
+	"sin":   math.Sin,
+	"cos":   math.Cos,
+	"tan":   math.Tan,
+	"floor": math.Floor,
+	"ceil":  math.Ceil,
+	"round": math.Round,
+}
+
+var calculatorConstants = map[string]float64{
+	"pi": math.Pi,
+	"e":  math.E,
+}
+
+// calcParser is a recursive-descent parser for the calculator grammar:
+//
+//	expr    = term { ("+" | "-") term }
+//	term    = unary { ("*" | "/" | "%") unary }
+//	unary   = ("+" | "-") unary | power
+//	power   = primary [ ("^" | "**") unary ]
+//	primary = number | name | name "(" expr ")" | "(" expr ")"
+type calcParser struct {
+	input string
+	pos   int
+}
+
+func (p *calcParser) skipSpace() {
+	for p.pos < len(p.input) && unicode.IsSpace(rune(p.input[p.pos])) {
+		p.pos++
+	}
+}
+
+func (p *calcParser) consume(op string) bool {
+	p.skipSpace()
+	if strings.HasPrefix(p.input[p.pos:], op) {
+		p.pos += len(op)
+		return true
+	}
+	return false
+}
+
+func (p *calcParser) parseExpr() (float64, error) {
+	x, err := p.parseTerm()
+	if err != nil {
+		return 0, err
+	}
+	for {
+		switch {
+		case p.consume("+"):
+			y, err := p.parseTerm()
+			if err != nil {
+				return 0, err
+			}
+			x += y
+		case p.consume("-"):
+			y, err := p.parseTerm()
+			if err != nil {
+				return 0, err
+			}
+			x -= y
+		default:
+			return x, nil
+		}
+	}
+}
+
+func (p *calcParser) parseTerm() (float64, error) {
+	x, err := p.parseUnary()
+	if err != nil {
+		return 0, err
+	}
+	for {
+		p.skipSpace()
+		if strings.HasPrefix(p.input[p.pos:], "**") {
+			return x, nil
+		}
+		switch {
+		case p.consume("*"):
+			y, err := p.parseUnary()
+			if err != nil {
+				return 0, err
+			}
+			x *= y
+		case p.consume("/"):
+			y, err := p.parseUnary()
+			if err != nil {
+				return 0, err
+			}
+			if y == 0 {
+				return 0, fmt.Errorf("division by zero")
+			}
+			x /= y
+		case p.consume("%"):
+			y, err := p.parseUnary()
+			if err != nil {
+				return 0, err
+			}
+			if y == 0 {
+				return 0, fmt.Errorf("division by zero")
+			}
+			x = math.Mod(x, y)
+		default:
+			return x, nil
+		}
+	}
+}
+
+func (p *calcParser) parseUnary() (float64, error) {
+	switch {
+	case p.consume("-"):
+		x, err := p.parseUnary()
+		return -x, err
+	case p.consume("+"):
+		return p.parseUnary()
+	}
+	return p.parsePower()
+}
+
+func (p *calcParser) parsePower() (float64, error) {
+	x, err := p.parsePrimary()
+	if err != nil {
+		return 0, err
+	}
+	if p.consume("**") || p.consume("^") {
+		y, err := p.parseUnary()
+		if err != nil {
+			return 0, err
+		}
+		return math.Pow(x, y), nil
+	}
+	return x, nil
+}
+
+func (p *calcParser) parsePrimary() (float64, error) {
+	p.skipSpace()
+	if p.consume("(") {
+		x, err := p.parseExpr()
+		if err != nil {
+			return 0, err
+		}
+		if !p.consume(")") {
+			return 0, fmt.Errorf("missing closing parenthesis")
+		}
+		return x, nil
+	}
+
+	start := p.pos
+	if p.pos < len(p.input) && unicode.IsLetter(rune(p.input[p.pos])) {
+		for p.pos < len(p.input) && (unicode.IsLetter(rune(p.input[p.pos])) || unicode.IsDigit(rune(p.input[p.pos]))) {
+			p.pos++
+		}
+		name := strings.ToLower(p.input[start:p.pos])
+		if p.consume("(") {
+			fn, ok := calculatorFuncs[name]
+			if !ok {
+				return 0, fmt.Errorf("unknown function %q", name)
+			}
+			x, err := p.parseExpr()
+			if err != nil {
+				return 0, err
+			}
+			if !p.consume(")") {
+				return 0, fmt.Errorf("missing closing parenthesis")
+			}
+			return fn(x), nil
+		}
+		value, ok := calculatorConstants[name]
+		if !ok {
+			return 0, fmt.Errorf("unknown name %q", name)
+		}
+		return value, nil
+	}
+
+	for p.pos < len(p.input) && (unicode.IsDigit(rune(p.input[p.pos])) || p.input[p.pos] == '.') {
+		p.pos++
+	}
+	// Allow an exponent such as 1.5e3.
+	if p.pos > start && p.pos < len(p.input) && (p.input[p.pos] == 'e' || p.input[p.pos] == 'E') {
+		end := p.pos + 1
+		if end < len(p.input) && (p.input[end] == '+' || p.input[end] == '-') {
+			end++
+		}
+		if end < len(p.input) && unicode.IsDigit(rune(p.input[end])) {
+			p.pos = end
+			for p.pos < len(p.input) && unicode.IsDigit(rune(p.input[p.pos])) {
+				p.pos++
+			}
+		}
+	}
+	if p.pos == start {
+		if p.pos >= len(p.input) {
+			return 0, fmt.Errorf("unexpected end of expression")
+		}
+		return 0, fmt.Errorf("unexpected %q at position %d", p.input[p.pos], p.pos)
+	}
+	return strconv.ParseFloat(p.input[start:p.pos], 64)
+}
+
+// CurrentDateTool reports the current date and time, optionally in an IANA
+// time zone.
+type CurrentDateTool struct{}
+
+func (CurrentDateTool) Name() string { return "current_date" }
+
+func (CurrentDateTool) Description() string {
+	return "Get the current date and time."
+}
+
+func (CurrentDateTool) Parameters() map[string]any {
+	return map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"timezone": map[string]any{"type": "string", "description": "IANA time zone such as \"Europe/Paris\". Defaults to UTC."},
+		},
+	}
+}
+
+func (CurrentDateTool) Call(ctx context.Context, args map[string]any) (string, error) {
+	now := time.Now().UTC()
+	if name, _ := args["timezone"].(string); name != "" {
+		loc, err := time.LoadLocation(name)
+		if err != nil {
+			return "", fmt.Errorf("unknown time zone %q", name)
+		}
+		now = now.In(loc)
+	}
+	return now.Format("Monday, January 2, 2006 15:04 MST"), nil
+}
+
+const (
+	defaultFetchTimeout  = 15 * time.Second
+	defaultFetchMaxBytes = 1 << 20
+	defaultFetchMaxChars = 8000
+)
+
+// FetchURLTool downloads a web page with Fetcher and returns its visible
+// text. Fetches therefore honour robots.txt, the per-host delay and the size
+// limit, and are refused for non-public addresses unless Fetcher is given an
+// HTTPClient that allows them.
+type FetchURLTool struct {
+	Fetcher  *PageFetcher
+	MaxChars int
+
+	once sync.Once
+}
+
+func (*FetchURLTool) Name() string { return "fetch_url" }
+
+func (*FetchURLTool) Description() string {
+	return "Fetch an http or https URL and return the text content of the page."
+}
+
+func (*FetchURLTool) Parameters() map[string]any {
+	return map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"url": map[string]any{"type": "string", "description": "The absolute URL to fetch."},
+		},
+		"required": []string{"url"},
+	}
+}
+
+func (t *FetchURLTool) Call(ctx context.Context, args map[string]any) (string, error) {
+	rawURL, _ := args["url"].(string)
+	t.once.Do(func() {
+		if t.Fetcher == nil {
+			t.Fetcher = &PageFetcher{}
+		}
+	})
+	page, err := t.Fetcher.Fetch(ctx, rawURL)
+	if err != nil {
+		return "", err
+	}
+
+	text := page.Text
+	if page.Title != "" {
+		text = page.Title + "\n\n" + text
+	}
+	maxChars := t.MaxChars
+	if maxChars <= 0 {
+		maxChars = defaultFetchMaxChars
+	}
+	return truncateRunes(text, maxChars), nil
+}
+
+// htmlText returns the visible text of an HTML document, one line per text
+// node, skipping scripts and styles.
+func htmlText(document string) string {
+	tokenizer := html.NewTokenizer(strings.NewReader(document))
+	var lines []string
+	skip := 0
+	for {
+		switch tokenizer.Next() {
+		case html.ErrorToken:
+			return strings.Join(lines, "\n")
+		case html.StartTagToken:
+			if name, _ := tokenizer.TagName(); isHiddenTag(string(name)) {
+				skip++
+			}
+		case html.EndTagToken:
+			if name, _ := tokenizer.TagName(); isHiddenTag(string(name)) && skip > 0 {
+				skip--
+			}
+		case html.TextToken:
+			if skip == 0 {
+				if line := strings.Join(strings.Fields(string(tokenizer.Text())), " "); line != "" {
+					lines = append(lines, line)
+				}
+			}
+		}
+	}
+}
+
+func isHiddenTag(name string) bool {
+	switch name {
+	case "script", "style", "noscript", "template":
+		return true
+	}
+	return false
+}
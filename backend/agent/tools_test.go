@@ -0,0 +1,59 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCalculatorTool(t *testing.T) {
+	tests := []struct {
+		expression string
+		want       string
+	}{
+		{"1 + 2 * 3", "7"},
+		{"(1 + 2) * 3", "9"},
+		{"10 / 4", "2.5"},
+		{"10 % 4", "2"},
+		{"-2 ^ 2", "-4"},
+		{"2 ** 3 ** 2", "512"},
+		{"sqrt(16) + abs(-1)", "5"},
+		{"round(pi * 100) / 100", "3.14"},
+		{"  12.5*4 ", "50"},
+	}
+	for _, tt := range tests {
+		got, err := CalculatorTool{}.Call(context.Background(), map[string]any{"expression": tt.expression})
+		if err != nil || got != tt.want {
+			t.Errorf("calculator(%q) = %q, %v, want %q", tt.expression, got, err, tt.want)
+		}
+	}
+
+	for _, expression := range []string{"", "1 +", "1 / 0", "1 % 0", "2 $ 3", "nope(1)", "(1 + 2"} {
+		if got, err := (CalculatorTool{}).Call(context.Background(), map[string]any{"expression": expression}); err == nil {
+			t.Errorf("calculator(%q) = %q, want an error", expression, got)
+		}
+	}
+}
+
+func TestFetchURLToolRefusesNonPublicAddresses(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("internal"))
+	}))
+	defer server.Close()
+
+	tool := &FetchURLTool{Fetcher: &PageFetcher{IgnoreRobots: true}}
+	for _, rawURL := range []string{server.URL, "http://169.254.169.254/latest/meta-data/"} {
+		if _, err := tool.Call(context.Background(), map[string]any{"url": rawURL}); !errors.Is(err, ErrPrivateAddress) {
+			t.Errorf("fetch_url(%s) = %v, want ErrPrivateAddress", rawURL, err)
+		}
+	}
+
+	// An explicit client opts out of the check, e.g. for tests and mirrors.
+	tool = &FetchURLTool{Fetcher: &PageFetcher{HTTPClient: server.Client(), IgnoreRobots: true}, MaxChars: 5}
+	got, err := tool.Call(context.Background(), map[string]any{"url": server.URL})
+	if err != nil || got != "inter" {
+		t.Errorf("fetch_url with a custom client = %q, %v", got, err)
+	}
+}
@@ -0,0 +1,120 @@
+package agent
+
+import "strings"
+
+// UsageMetadata is the token accounting Gemini returns with every response.
+type UsageMetadata struct {
+	PromptTokenCount        int `json:"promptTokenCount,omitempty"`
+	CandidatesTokenCount    int `json:"candidatesTokenCount,omitempty"`
+	ThoughtsTokenCount      int `json:"thoughtsTokenCount,omitempty"`
+	CachedContentTokenCount int `json:"cachedContentTokenCount,omitempty"`
+	TotalTokenCount         int `json:"totalTokenCount,omitempty"`
+}
+
+func (u *UsageMetadata) Add(other UsageMetadata) {
+	u.PromptTokenCount += other.PromptTokenCount
+	u.CandidatesTokenCount += other.CandidatesTokenCount
+	u.ThoughtsTokenCount += other.ThoughtsTokenCount
+	u.CachedContentTokenCount += other.CachedContentTokenCount
+	u.TotalTokenCount += other.TotalTokenCount
+}
+
+// ModelPrice is the USD price per million tokens. Thinking tokens are billed
+// as output.
+type ModelPrice struct {
+	InputPerMillion       float64
+	CachedInputPerMillion float64
+	OutputPerMillion      float64
+}
+
+// DefaultModelPrices are list prices at the time of writing and only meant
+// for estimates. Model names are matched by longest prefix.
+var DefaultModelPrices = map[string]ModelPrice{
+	"gemini-2.0-flash-lite": {InputPerMillion: 0.075, CachedInputPerMillion: 0.01875, OutputPerMillion: 0.30},
+	"gemini-2.0-flash":      {InputPerMillion: 0.10, CachedInputPerMillion: 0.025, OutputPerMillion: 0.40},
+	"gemini-2.5-flash":      {InputPerMillion: 0.30, CachedInputPerMillion: 0.075, OutputPerMillion: 2.50},
+	"gemini-2.5-pro":        {InputPerMillion: 1.25, CachedInputPerMillion: 0.31, OutputPerMillion: 10.00},
+}
+
+func lookupPrice(prices map[string]ModelPrice, model string) (ModelPrice, bool) {
+	model = strings.TrimPrefix(model, "models/")
+	if price, ok := prices[model]; ok {
+		return price, true
+	}
+	best := ""
+	for name := range prices {
+		if strings.HasPrefix(model, name) && len(name) > len(best) {
+			best = name
+		}
+	}
+	if best == "" {
+		return ModelPrice{}, false
+	}
+	return prices[best], true
+}
+
+// EstimateCost prices usage for model. Models missing from prices cost 0.
+func EstimateCost(prices map[string]ModelPrice, model string, usage UsageMetadata) float64 {
+	price, ok := lookupPrice(prices, model)
+	if !ok {
+		return 0
+	}
+	uncached := usage.PromptTokenCount - usage.CachedContentTokenCount
+	output := usage.CandidatesTokenCount + usage.ThoughtsTokenCount
+	return (float64(uncached)*price.InputPerMillion +
+		float64(usage.CachedContentTokenCount)*price.CachedInputPerMillion +
+		float64(output)*price.OutputPerMillion) / 1e6
+}
+
+type UsageRecord struct {
+	Node          string
+	Model         string
+	Usage         UsageMetadata
+	EstimatedCost float64
+}
+
+// RunUsage accumulates token usage and estimated cost over a research run.
+// CacheHits and CacheMisses count response cache lookups and stay zero when
+// the cache is disabled.
+type RunUsage struct {
+	Calls         []UsageRecord
+	ByNode        map[string]UsageMetadata
+	Total         UsageMetadata
+	EstimatedCost float64
+	CacheHits     int
+	CacheMisses   int
+}
+
+// Record adds one model call. model is the model that served the call, so
+// Calls also records where fallbacks happened.
+func (r *RunUsage) Record(node, model string, usage *UsageMetadata, prices map[string]ModelPrice) {
+	if usage == nil {
+		usage = &UsageMetadata{}
+	}
+	record := UsageRecord{
+		Node:          node,
+		Model:         model,
+		Usage:         *usage,
+		EstimatedCost: EstimateCost(prices, model, *usage),
+	}
+	r.Calls = append(r.Calls, record)
+
+	if r.ByNode == nil {
+		r.ByNode = make(map[string]UsageMetadata)
+	}
+	byNode := r.ByNode[node]
+	byNode.Add(*usage)
+	r.ByNode[node] = byNode
+
+	r.Total.Add(*usage)
+	r.EstimatedCost += record.EstimatedCost
+}
+
+// RecordCacheLookup counts one response cache lookup.
+func (r *RunUsage) RecordCacheLookup(hit bool) {
+	if hit {
+		r.CacheHits++
+	} else {
+		r.CacheMisses++
+	}
+}
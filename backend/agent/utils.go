@@ -1,10 +1,11 @@
 package agent
 
 import (
-	"fmt"
+	"slices"
 	"sort"
 	"strings"
 	"time"
+	"unicode/utf8"
 )
 
 type GroundingChunk struct {
@@ -16,135 +17,167 @@ type GroundingChunk struct {
 
 type GroundingSupport struct {
 	Segment struct {
-		StartIndex int `json:"start_index"`
-		EndIndex   int `json:"end_index"`
+		StartIndex int `json:"startIndex"`
+		EndIndex   int `json:"endIndex"`
 	} `json:"segment"`
-	GroundingChunkIndices []int `json:"grounding_chunk_indices"`
+	GroundingChunkIndices []int `json:"groundingChunkIndices"`
 }
 
 type GroundingMetadata struct {
-	GroundingSupports []GroundingSupport `json:"grounding_supports"`
-	GroundingChunks   []GroundingChunk   `json:"grounding_chunks"`
+	GroundingSupports []GroundingSupport `json:"groundingSupports"`
+	GroundingChunks   []GroundingChunk   `json:"groundingChunks"`
 }
 
 type LLMResponse struct {
 	Candidates []struct {
-		GroundingMetadata GroundingMetadata `json:"grounding_metadata"`
+		GroundingMetadata GroundingMetadata `json:"groundingMetadata"`
 	} `json:"candidates"`
 	Text string `json:"text"`
 }
 
-func GetResearchTopic(messages []Message) string {
-	if len(messages) == 1 {
-		return messages[len(messages)-1].GetContent()
-	}
-
-	var researchTopic strings.Builder
-	for _, message := range messages {
-		if _, ok := message.(HumanMessage); ok {
-			researchTopic.WriteString(fmt.Sprintf("User: %s\n", message.GetContent()))
-		} else if _, ok := message.(AIMessage); ok {
-			researchTopic.WriteString(fmt.Sprintf("Assistant: %s\n", message.GetContent()))
+// GetLatestQuestion returns the most recent human message, which is the
+// question the current run is answering.
+func GetLatestQuestion(messages []Message) string {
+	for i := len(messages) - 1; i >= 0; i-- {
+		if message, ok := messages[i].(HumanMessage); ok {
+			return message.Content
 		}
 	}
-	return researchTopic.String()
+	return ""
 }
 
-func ResolveURLs(urlsToResolve []GroundingChunk, id int) map[string]string {
-	prefix := "https://vertexaisearch.cloud.google.com/id/"
+// ResolveURLs registers each grounding chunk's URL with registry and maps it
+// to the source's short URL.
+func ResolveURLs(urlsToResolve []GroundingChunk, registry *CitationRegistry) map[string]string {
 	resolvedMap := make(map[string]string)
 
-	for idx, chunk := range urlsToResolve {
+	for _, chunk := range urlsToResolve {
 		url := chunk.Web.URI
 		if _, exists := resolvedMap[url]; !exists {
-			resolvedMap[url] = fmt.Sprintf("%s%d-%d", prefix, id, idx)
+			resolvedMap[url] = registry.Register(url, chunk.Web.Title).ShortURL
 		}
 	}
 	return resolvedMap
 }
 
-func InsertCitationMarkers(text string, citationsList []map[string]interface{}) string {
-	sort.Slice(citationsList, func(i, j int) bool {
-		endI := citationsList[i]["end_index"].(int)
-		endJ := citationsList[j]["end_index"].(int)
-		if endI != endJ {
-			return endI > endJ
+// CitationSegment is one source backing a span of grounded text. ShortURL is
+// the source's placeholder from the run's CitationRegistry and Value its
+// real URL.
+type CitationSegment struct {
+	Label    string
+	ShortURL string
+	Value    string
+}
+
+// Citation is a span of text, as UTF-8 byte offsets, and the sources that
+// support it.
+type Citation struct {
+	StartIndex int
+	EndIndex   int
+	Segments   []CitationSegment
+}
+
+// InsertCitationMarkers adds a marker for each citation's sources at the end
+// of its span, linking to their short URLs. Citations that end at the same
+// offset share one run of markers, without repeating a source. Sources are
+// numbered from 1 in order of first citation. A nil format writes Markdown
+// links.
+func InsertCitationMarkers(text string, citationsList []Citation, format MarkerFormat) string {
+	if format == nil {
+		format = MarkdownMarkers{}
+	}
+	citations := append([]Citation(nil), citationsList...)
+	sort.SliceStable(citations, func(i, j int) bool {
+		if citations[i].EndIndex != citations[j].EndIndex {
+			return citations[i].EndIndex < citations[j].EndIndex
 		}
-		startI := citationsList[i]["start_index"].(int)
-		startJ := citationsList[j]["start_index"].(int)
-		return startI > startJ
+		return citations[i].StartIndex < citations[j].StartIndex
 	})
 
-	modifiedText := text
-	for _, citationInfo := range citationsList {
-		endIdx := citationInfo["end_index"].(int)
-		markerToInsert := ""
-		segments, ok := citationInfo["segments"].([]interface{})
-		if !ok {
-			continue
+	numbers := make(map[string]int)
+	type insertion struct {
+		offset   int
+		segments []CitationSegment
+	}
+	var insertions []insertion
+	for _, citation := range citations {
+		offset := runeBoundary(text, citation.EndIndex)
+		if len(insertions) == 0 || insertions[len(insertions)-1].offset != offset {
+			insertions = append(insertions, insertion{offset: offset})
 		}
-		for _, seg := range segments {
-			segmentMap, ok := seg.(map[string]interface{})
-			if !ok {
-				continue
+		current := &insertions[len(insertions)-1]
+		for _, segment := range citation.Segments {
+			if numbers[segment.ShortURL] == 0 {
+				numbers[segment.ShortURL] = len(numbers) + 1
+			}
+			if !slices.ContainsFunc(current.segments, func(s CitationSegment) bool { return s.ShortURL == segment.ShortURL }) {
+				current.segments = append(current.segments, segment)
 			}
-			label, _ := segmentMap["label"].(string)
-			shortURL, _ := segmentMap["short_url"].(string)
-			markerToInsert += fmt.Sprintf(" [%s](%s)", label, shortURL)
 		}
-
-		modifiedText = modifiedText[:endIdx] + markerToInsert + modifiedText[endIdx:]
 	}
 
+	modifiedText := text
+	for i := len(insertions) - 1; i >= 0; i-- {
+		var marker strings.Builder
+		for _, segment := range insertions[i].segments {
+			marker.WriteString(" ")
+			marker.WriteString(format.Marker(segment.Label, segment.ShortURL, numbers[segment.ShortURL]))
+		}
+		offset := insertions[i].offset
+		modifiedText = modifiedText[:offset] + marker.String() + modifiedText[offset:]
+	}
 	return modifiedText
 }
 
-func GetCitations(response *LLMResponse, resolvedURLsMap map[string]string) []map[string]interface{} {
-	citations := []map[string]interface{}{}
+// runeBoundary clamps a byte offset into text and moves it forward to the
+// start of a rune, so a marker never splits a multi-byte character.
+func runeBoundary(text string, offset int) int {
+	offset = max(0, min(offset, len(text)))
+	for offset < len(text) && !utf8.RuneStart(text[offset]) {
+		offset++
+	}
+	return offset
+}
+
+// GetCitations turns the grounding supports of response into citations,
+// keeping only the chunks whose URLs are in resolvedURLsMap.
+func GetCitations(response *LLMResponse, resolvedURLsMap map[string]string) []Citation {
+	var citations []Citation
 
 	if response == nil || len(response.Candidates) == 0 {
 		return citations
 	}
 
 	candidate := response.Candidates[0]
-	if len(candidate.GroundingMetadata.GroundingSupports) == 0 {
-		return citations
-	}
-
 	for _, support := range candidate.GroundingMetadata.GroundingSupports {
-		citation := make(map[string]interface{})
-
-		if support.Segment.EndIndex == 0 && support.Segment.StartIndex == 0 && support.Segment.EndIndex <= support.Segment.StartIndex {
+		if support.Segment.EndIndex <= support.Segment.StartIndex {
 			continue
 		}
 
-		citation["start_index"] = support.Segment.StartIndex
-		citation["end_index"] = support.Segment.EndIndex
-
-		segmentsData := []map[string]interface{}{}
+		citation := Citation{StartIndex: support.Segment.StartIndex, EndIndex: support.Segment.EndIndex}
 		for _, ind := range support.GroundingChunkIndices {
-			if ind >= 0 && ind < len(candidate.GroundingMetadata.GroundingChunks) {
-				chunk := candidate.GroundingMetadata.GroundingChunks[ind]
-				resolvedURL, ok := resolvedURLsMap[chunk.Web.URI]
-				if !ok {
-					continue
-				}
-
-				titleParts := strings.Split(chunk.Web.Title, ".")
-				label := chunk.Web.Title
-				if len(titleParts) > 1 {
-					label = titleParts[0]
-				}
-
-				segmentsData = append(segmentsData, map[string]interface{}{
-					"label":     label,
-					"short_url": resolvedURL,
-					"value":     chunk.Web.URI,
-				})
+			if ind < 0 || ind >= len(candidate.GroundingMetadata.GroundingChunks) {
+				continue
+			}
+			chunk := candidate.GroundingMetadata.GroundingChunks[ind]
+			resolvedURL, ok := resolvedURLsMap[chunk.Web.URI]
+			if !ok {
+				continue
+			}
+
+			label := chunk.Web.Title
+			if titleParts := strings.Split(chunk.Web.Title, "."); len(titleParts) > 1 {
+				label = titleParts[0]
 			}
+			citation.Segments = append(citation.Segments, CitationSegment{
+				Label:    label,
+				ShortURL: resolvedURL,
+				Value:    chunk.Web.URI,
+			})
+		}
+		if len(citation.Segments) > 0 {
+			citations = append(citations, citation)
 		}
-		citation["segments"] = segmentsData
-		citations = append(citations, citation)
 	}
 	return citations
 }
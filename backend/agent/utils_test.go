@@ -0,0 +1,39 @@
+package agent
+
+import (
+	"testing"
+	"unicode/utf8"
+)
+
+func TestInsertCitationMarkers(t *testing.T) {
+	paris := CitationSegment{Label: "paris", ShortURL: "https://vertexaisearch.cloud.google.com/id/1"}
+	france := CitationSegment{Label: "france", ShortURL: "https://vertexaisearch.cloud.google.com/id/2"}
+	text := "Paris is the capital. France is in Europe."
+
+	got := InsertCitationMarkers(text, []Citation{
+		{StartIndex: 22, EndIndex: 42, Segments: []CitationSegment{france}},
+		{StartIndex: 0, EndIndex: 21, Segments: []CitationSegment{paris}},
+		{StartIndex: 0, EndIndex: 21, Segments: []CitationSegment{paris, france}},
+	}, FootnoteMarkers{})
+	want := "Paris is the capital. [1] [2] France is in Europe. [2]"
+	if got != want {
+		t.Errorf("InsertCitationMarkers() =\n%q\nwant\n%q", got, want)
+	}
+}
+
+func TestInsertCitationMarkersKeepsRunesWhole(t *testing.T) {
+	segment := CitationSegment{Label: "café", ShortURL: "https://vertexaisearch.cloud.google.com/id/1"}
+	text := "Café au lait"
+
+	// Offset 4 falls inside the two-byte "é".
+	got := InsertCitationMarkers(text, []Citation{{StartIndex: 0, EndIndex: 4, Segments: []CitationSegment{segment}}}, nil)
+	want := "Café [café](https://vertexaisearch.cloud.google.com/id/1) au lait"
+	if got != want {
+		t.Errorf("InsertCitationMarkers() = %q, want %q", got, want)
+	}
+
+	got = InsertCitationMarkers(text, []Citation{{StartIndex: 0, EndIndex: 100, Segments: []CitationSegment{segment}}}, nil)
+	if !utf8.ValidString(got) || got != text+" [café](https://vertexaisearch.cloud.google.com/id/1)" {
+		t.Errorf("out of range offset: %q", got)
+	}
+}
@@ -0,0 +1,300 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// Claim verification modes, as accepted by Configuration.VerifyClaims.
+const (
+	VerifyClaimsAnnotate = "annotate"
+	VerifyClaimsRewrite  = "rewrite"
+)
+
+// Claim verdicts.
+const (
+	ClaimSupported    = "supported"
+	ClaimUnsupported  = "unsupported"
+	ClaimContradicted = "contradicted"
+)
+
+// claimAnnotations are the notes VerifyClaimsAnnotate adds to claims that
+// are not supported.
+var claimAnnotations = map[string]string{
+	ClaimUnsupported:  "(not supported by the sources)",
+	ClaimContradicted: "(contradicted by the sources)",
+}
+
+// Claim is one sentence of an answer. Start and End are byte offsets into
+// the answer.
+type Claim struct {
+	Text  string
+	Start int
+	End   int
+}
+
+// ClaimVerdict is the verifier's judgement of one claim. Number is the
+// claim's position in the answer, from 1. SourceIDs are citation registry
+// IDs and Sources their URLs.
+type ClaimVerdict struct {
+	Number    int      `json:"claim"`
+	Text      string   `json:"-"`
+	Verdict   string   `json:"verdict"`
+	SourceIDs []int    `json:"source_ids"`
+	Sources   []string `json:"-"`
+	Reason    string   `json:"reason"`
+	Revision  string   `json:"revision,omitempty"`
+}
+
+// Supported reports whether the sources back the claim.
+func (v ClaimVerdict) Supported() bool {
+	return v.Verdict == ClaimSupported
+}
+
+type ClaimVerification struct {
+	Claims []ClaimVerdict `json:"claims"`
+}
+
+var (
+	referenceDefinitionPattern = regexp.MustCompile(`^\[\d+\]:\s`)
+	listMarkerPattern          = regexp.MustCompile(`^([-*+>]|\d+[.)])\s+`)
+)
+
+// SplitClaims splits an answer into sentences. Headings, code blocks and
+// footnote reference definitions are skipped, list markers are left out of
+// the claims and a citation marker right after a sentence's full stop stays
+// with that sentence.
+func SplitClaims(text string) []Claim {
+	var claims []Claim
+	inCode := false
+	for start := 0; start <= len(text); {
+		end := strings.IndexByte(text[start:], '\n')
+		if end < 0 {
+			end = len(text)
+		} else {
+			end += start
+		}
+		if strings.HasPrefix(strings.TrimSpace(text[start:end]), "```") {
+			inCode = !inCode
+		} else if !inCode {
+			claims = appendLineClaims(claims, text, start, end)
+		}
+		start = end + 1
+	}
+	return claims
+}
+
+func appendLineClaims(claims []Claim, text string, start, end int) []Claim {
+	trimmed := strings.TrimSpace(text[start:end])
+	if trimmed == "" || strings.HasPrefix(trimmed, "#") || referenceDefinitionPattern.MatchString(trimmed) {
+		return claims
+	}
+	position := start + len(text[start:end]) - len(strings.TrimLeft(text[start:end], " \t"))
+	position += len(listMarkerPattern.FindString(text[position:end]))
+
+	sentenceStart := position
+	for i := position; i < end; {
+		switch text[i] {
+		case '[', '<':
+			if next := skipMarker(text, i, end); next > 0 {
+				i = next
+				continue
+			}
+		case '.', '!', '?':
+			next := i + 1
+			for next < end && strings.IndexByte(`.!?)"'*_`, text[next]) >= 0 {
+				next++
+			}
+			for next < end {
+				skipped := skipMarker(text, next, end)
+				if skipped < 0 {
+					break
+				}
+				next = skipped
+			}
+			if next == end || text[next] == ' ' || text[next] == '\t' {
+				claims = appendClaim(claims, text, sentenceStart, next)
+				sentenceStart = next
+			}
+			i = next
+			continue
+		}
+		i++
+	}
+	return appendClaim(claims, text, sentenceStart, end)
+}
+
+// skipMarker returns the offset just past the Markdown link, bracketed
+// footnote marker or HTML tag at text[i], or -1 when there is none.
+func skipMarker(text string, i, end int) int {
+	switch {
+	case text[i] == '[':
+		closing := strings.IndexByte(text[i:end], ']')
+		if closing < 0 {
+			return -1
+		}
+		next := i + closing + 1
+		if next < end && text[next] == '(' {
+			if paren := strings.IndexByte(text[next:end], ')'); paren >= 0 {
+				next += paren + 1
+			}
+		}
+		return next
+	case text[i] == '<' && i+1 < end && (text[i+1] == '/' || unicode.IsLetter(rune(text[i+1]))):
+		if closing := strings.IndexByte(text[i:end], '>'); closing >= 0 {
+			return i + closing + 1
+		}
+	}
+	return -1
+}
+
+func appendClaim(claims []Claim, text string, start, end int) []Claim {
+	for start < end && (text[start] == ' ' || text[start] == '\t') {
+		start++
+	}
+	for end > start && (text[end-1] == ' ' || text[end-1] == '\t' || text[end-1] == '\r') {
+		end--
+	}
+	if strings.IndexFunc(text[start:end], unicode.IsLetter) < 0 {
+		return claims
+	}
+	return append(claims, Claim{Text: text[start:end], Start: start, End: end})
+}
+
+// verdicts matches the verifier's judgements to claims and resolves their
+// source IDs with registry. Claims the verifier skipped and unrecognised
+// verdicts count as unsupported. Short URLs in the recorded claim text are
+// resolved.
+func (v ClaimVerification) verdicts(claims []Claim, registry *CitationRegistry) []ClaimVerdict {
+	byNumber := make(map[int]ClaimVerdict)
+	for _, verdict := range v.Claims {
+		if verdict.Number >= 1 && verdict.Number <= len(claims) {
+			if _, ok := byNumber[verdict.Number]; !ok {
+				byNumber[verdict.Number] = verdict
+			}
+		}
+	}
+
+	var verdicts []ClaimVerdict
+	for i, claim := range claims {
+		verdict, ok := byNumber[i+1]
+		if !ok {
+			verdict = ClaimVerdict{Number: i + 1, Reason: "no verdict from the verifier"}
+		}
+		verdict.Text, _ = registry.Resolve(claim.Text)
+		verdict.Verdict = strings.ToLower(strings.TrimSpace(verdict.Verdict))
+		if verdict.Verdict != ClaimSupported && verdict.Verdict != ClaimContradicted {
+			verdict.Verdict = ClaimUnsupported
+		}
+		verdict.Revision = strings.TrimSpace(verdict.Revision)
+
+		var ids []int
+		for _, id := range verdict.SourceIDs {
+			if source, ok := registry.byID(id); ok {
+				ids = append(ids, id)
+				verdict.Sources = append(verdict.Sources, source.URL)
+			}
+		}
+		verdict.SourceIDs = ids
+		verdicts = append(verdicts, verdict)
+	}
+	return verdicts
+}
+
+// applyVerdicts annotates, or with VerifyClaimsRewrite replaces, the claims
+// in a draft answer that are not supported. A rewritten claim without a
+// revision is removed along with its citations.
+func applyVerdicts(answer string, claims []Claim, verdicts []ClaimVerdict, mode string) string {
+	for i := len(verdicts) - 1; i >= 0; i-- {
+		verdict := verdicts[i]
+		if verdict.Supported() {
+			continue
+		}
+		claim := claims[verdict.Number-1]
+
+		if mode == VerifyClaimsRewrite {
+			start, end := claim.Start, claim.End
+			if verdict.Revision == "" {
+				if end < len(answer) && answer[end] == ' ' {
+					end++
+				} else if start > 0 && answer[start-1] == ' ' {
+					start--
+				}
+			}
+			answer = answer[:start] + verdict.Revision + answer[end:]
+			continue
+		}
+
+		at := claim.End
+		if strings.IndexByte(".!?", answer[at-1]) >= 0 {
+			at--
+		}
+		answer = answer[:at] + " " + claimAnnotations[verdict.Verdict] + answer[at:]
+	}
+	return answer
+}
+
+// VerifyClaimsNode checks each claim in the final answer against the web
+// research and records a verdict for it. Depending on VerifyClaims, claims
+// the research does not support are annotated or rewritten. Claims are taken
+// from the answer draft, so their citations name registry IDs, and the
+// edited draft is rendered again so citation markers, references and the
+// bibliography only cover the sources that are still cited.
+func (n *Nodes) VerifyClaimsNode(ctx context.Context, state *OverallState) (*OverallState, string, error) {
+	if state.BudgetExceeded || len(state.Messages) == 0 {
+		return state, "__END__", nil
+	}
+	answer, ok := state.Messages[len(state.Messages)-1].(AIMessage)
+	if !ok {
+		return state, "__END__", nil
+	}
+	claims := SplitClaims(state.AnswerDraft)
+	if len(claims) == 0 {
+		return state, "__END__", nil
+	}
+
+	llm := n.reasoningLLM.WithModels(n.config.reflectionChain(state.ReasoningModel)).WithThinking(n.config.ReflectionThinking)
+	llm.Temperature = 0
+
+	prompts, err := n.promptSet(state)
+	if err != nil {
+		return nil, "", err
+	}
+	var numbered strings.Builder
+	for i, claim := range claims {
+		fmt.Fprintf(&numbered, "%d. %s\n", i+1, claim.Text)
+	}
+	formatted_prompt, err := prompts.ClaimVerifier.Render(ClaimVerifierPromptData{
+		CurrentDate:   GetCurrentDate(),
+		ResearchTopic: GetLatestQuestion(state.Messages),
+		Claims:        numbered.String(),
+		Summaries:     strings.Join(state.WebResearchResults, "\n---\n\n"),
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	result, err := llm.WithStructuredOutput(ClaimVerification{}).Invoke(ctx, formatted_prompt)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to verify claims: %w", err)
+	}
+	n.recordUsage(ctx, state, result.Model, result.UsageMetadata, result.Cached)
+
+	var verification ClaimVerification
+	if err := json.Unmarshal([]byte(result.Content), &verification); err != nil {
+		return nil, "", fmt.Errorf("failed to unmarshal ClaimVerification: %w", err)
+	}
+
+	state.ClaimVerdicts = verification.verdicts(claims, state.Citations)
+	state.AnswerDraft = applyVerdicts(state.AnswerDraft, claims, state.ClaimVerdicts, n.config.VerifyClaims)
+	if err := n.renderAnswer(state, &answer); err != nil {
+		return nil, "", err
+	}
+	state.Messages[len(state.Messages)-1] = answer
+
+	return state, "__END__", nil
+}
@@ -0,0 +1,98 @@
+package agent
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitClaims(t *testing.T) {
+	tests := []struct {
+		name   string
+		answer string
+		want   []string
+	}{
+		{
+			name:   "sentences keep their citations",
+			answer: "Paris is the capital [Paris](https://example.com/paris). It has 2.1 million residents.[1] Is it big? Yes!",
+			want:   []string{"Paris is the capital [Paris](https://example.com/paris).", "It has 2.1 million residents.[1]", "Is it big?", "Yes!"},
+		},
+		{
+			name:   "headings, code and reference definitions are skipped",
+			answer: "# Answer\n\nParis is the capital.\n\n```\nnot. a claim.\n```\n\n[1]: https://example.com/paris",
+			want:   []string{"Paris is the capital."},
+		},
+		{
+			name:   "list markers are left out",
+			answer: "- First point.\n2. Second point.\n> Quoted point.",
+			want:   []string{"First point.", "Second point.", "Quoted point."},
+		},
+		{
+			name:   "abbreviations in a link do not split",
+			answer: "See [e.g. this page](https://example.com/a.b) for details.",
+			want:   []string{"See [e.g. this page](https://example.com/a.b) for details."},
+		},
+		{
+			name:   "lines without letters are not claims",
+			answer: "---\n42.\n",
+			want:   nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := SplitClaims(tt.answer)
+			var got []string
+			for _, claim := range claims {
+				if tt.answer[claim.Start:claim.End] != claim.Text {
+					t.Errorf("claim %q does not match its offsets", claim.Text)
+				}
+				got = append(got, claim.Text)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("SplitClaims() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyVerdicts(t *testing.T) {
+	answer := "Paris is the capital. It has 40 million residents. It hosted the 1896 Olympics."
+	claims := SplitClaims(answer)
+	verdicts := []ClaimVerdict{
+		{Number: 1, Verdict: ClaimSupported},
+		{Number: 2, Verdict: ClaimContradicted, Revision: "It has about 2.1 million residents."},
+		{Number: 3, Verdict: ClaimUnsupported},
+	}
+
+	if got, want := applyVerdicts(answer, claims, verdicts, VerifyClaimsAnnotate),
+		"Paris is the capital. It has 40 million residents (contradicted by the sources). It hosted the 1896 Olympics (not supported by the sources)."; got != want {
+		t.Errorf("annotate:\n%q\nwant\n%q", got, want)
+	}
+	if got, want := applyVerdicts(answer, claims, verdicts, VerifyClaimsRewrite),
+		"Paris is the capital. It has about 2.1 million residents."; got != want {
+		t.Errorf("rewrite:\n%q\nwant\n%q", got, want)
+	}
+}
+
+func TestClaimVerificationVerdicts(t *testing.T) {
+	registry := NewCitationRegistry()
+	source := registry.Register("https://example.com/paris", "Paris")
+	answer := "Paris is the capital [Paris](" + source.ShortURL + "). It has 40 million residents. It hosted the 1896 Olympics."
+	claims := SplitClaims(answer)
+
+	verification := ClaimVerification{Claims: []ClaimVerdict{
+		{Number: 1, Verdict: " Supported ", SourceIDs: []int{source.ID, 9}},
+		{Number: 2, Verdict: "doubtful"},
+		{Number: 2, Verdict: ClaimSupported},
+		{Number: 7, Verdict: ClaimSupported},
+	}}
+	got := verification.verdicts(claims, registry)
+
+	want := []ClaimVerdict{
+		{Number: 1, Text: "Paris is the capital [Paris](https://example.com/paris).", Verdict: ClaimSupported, SourceIDs: []int{source.ID}, Sources: []string{"https://example.com/paris"}},
+		{Number: 2, Text: "It has 40 million residents.", Verdict: ClaimUnsupported},
+		{Number: 3, Text: "It hosted the 1896 Olympics.", Verdict: ClaimUnsupported, Reason: "no verdict from the verifier"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("verdicts() =\n%+v\nwant\n%+v", got, want)
+	}
+}
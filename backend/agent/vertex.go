@@ -0,0 +1,266 @@
+package agent
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultTokenURL    = "https://oauth2.googleapis.com/token"
+	cloudPlatformScope = "https://www.googleapis.com/auth/cloud-platform"
+
+	jwtBearerGrantType = "urn:ietf:params:oauth:grant-type:jwt-bearer"
+	jwtLifetime        = time.Hour
+
+	// tokenRefreshMargin renews tokens this long before they expire so a
+	// request never goes out with a token that lapses in flight.
+	tokenRefreshMargin = time.Minute
+)
+
+// VertexEndpoint addresses Gemini models through Vertex AI at
+// projects/{Project}/locations/{Location}/publishers/google/models/{model}.
+type VertexEndpoint struct {
+	Project  string
+	Location string
+}
+
+func (v *VertexEndpoint) modelURL(baseURL, model, method string) string {
+	location := v.Location
+	if location == "" {
+		location = "us-central1"
+	}
+	if baseURL == "" {
+		host := location + "-aiplatform.googleapis.com"
+		if location == "global" {
+			host = "aiplatform.googleapis.com"
+		}
+		baseURL = "https://" + host + "/v1"
+	}
+	return fmt.Sprintf("%s/projects/%s/locations/%s/publishers/google/models/%s:%s",
+		strings.TrimRight(baseURL, "/"), v.Project, location, model, method)
+}
+
+// TokenSource supplies OAuth2 access tokens for Vertex AI requests.
+type TokenSource interface {
+	Token(ctx context.Context) (string, error)
+}
+
+// ServiceAccountKey is the subset of a service-account JSON key file needed
+// to mint access tokens.
+type ServiceAccountKey struct {
+	Type         string `json:"type"`
+	ProjectID    string `json:"project_id"`
+	PrivateKeyID string `json:"private_key_id"`
+	PrivateKey   string `json:"private_key"`
+	ClientEmail  string `json:"client_email"`
+	TokenURI     string `json:"token_uri"`
+}
+
+func LoadServiceAccountKey(path string) (*ServiceAccountKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read service account key: %w", err)
+	}
+	var key ServiceAccountKey
+	if err := json.Unmarshal(data, &key); err != nil {
+		return nil, fmt.Errorf("failed to parse service account key %s: %w", path, err)
+	}
+	if key.Type != "service_account" {
+		return nil, fmt.Errorf("%s is a %q credential, not a service account key", path, key.Type)
+	}
+	if key.ClientEmail == "" || key.PrivateKey == "" {
+		return nil, fmt.Errorf("service account key %s is missing client_email or private_key", path)
+	}
+	return &key, nil
+}
+
+// ServiceAccountTokenSource exchanges a self-signed RS256 JWT for an access
+// token and caches it until shortly before it expires. TokenURL overrides
+// the key's token_uri, e.g. to point at a local stub.
+type ServiceAccountTokenSource struct {
+	Key        *ServiceAccountKey
+	TokenURL   string
+	Scopes     []string
+	HTTPClient *http.Client
+
+	mu         sync.Mutex
+	privateKey *rsa.PrivateKey
+	token      string
+	expiry     time.Time
+}
+
+func NewServiceAccountTokenSource(key *ServiceAccountKey, tokenURL string) (*ServiceAccountTokenSource, error) {
+	privateKey, err := parsePrivateKey(key.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+	return &ServiceAccountTokenSource{Key: key, TokenURL: tokenURL, privateKey: privateKey}, nil
+}
+
+func parsePrivateKey(data string) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode([]byte(data))
+	if block == nil {
+		return nil, errors.New("service account private key is not PEM encoded")
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse service account private key: %w", err)
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("service account private key is not an RSA key")
+	}
+	return key, nil
+}
+
+func (s *ServiceAccountTokenSource) Token(ctx context.Context) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.token != "" && time.Now().Before(s.expiry.Add(-tokenRefreshMargin)) {
+		return s.token, nil
+	}
+	if s.privateKey == nil {
+		privateKey, err := parsePrivateKey(s.Key.PrivateKey)
+		if err != nil {
+			return "", err
+		}
+		s.privateKey = privateKey
+	}
+
+	tokenURL := s.tokenURL()
+	assertion, err := s.signJWT(tokenURL, time.Now())
+	if err != nil {
+		return "", err
+	}
+	form := url.Values{"grant_type": {jwtBearerGrantType}, "assertion": {assertion}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", fmt.Errorf("failed to build token request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	httpClient := s.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return "", fmt.Errorf("token endpoint returned %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	var token struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.Unmarshal(body, &token); err != nil {
+		return "", fmt.Errorf("failed to unmarshal token response: %w", err)
+	}
+	if token.AccessToken == "" {
+		return "", errors.New("token endpoint returned no access_token")
+	}
+	s.token = token.AccessToken
+	s.expiry = time.Now().Add(time.Duration(token.ExpiresIn) * time.Second)
+	return s.token, nil
+}
+
+func (s *ServiceAccountTokenSource) tokenURL() string {
+	switch {
+	case s.TokenURL != "":
+		return s.TokenURL
+	case s.Key.TokenURI != "":
+		return s.Key.TokenURI
+	}
+	return defaultTokenURL
+}
+
+// signJWT builds the RS256-signed assertion for the jwt-bearer grant.
+func (s *ServiceAccountTokenSource) signJWT(audience string, now time.Time) (string, error) {
+	scopes := s.Scopes
+	if len(scopes) == 0 {
+		scopes = []string{cloudPlatformScope}
+	}
+	header := map[string]string{"alg": "RS256", "typ": "JWT"}
+	if s.Key.PrivateKeyID != "" {
+		header["kid"] = s.Key.PrivateKeyID
+	}
+	claims := map[string]any{
+		"iss":   s.Key.ClientEmail,
+		"scope": strings.Join(scopes, " "),
+		"aud":   audience,
+		"iat":   now.Unix(),
+		"exp":   now.Add(jwtLifetime).Unix(),
+	}
+
+	headerJSON, err := json.Marshal(header)
+	if err != nil {
+		return "", err
+	}
+	claimsJSON, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	signingInput := base64.RawURLEncoding.EncodeToString(headerJSON) + "." + base64.RawURLEncoding.EncodeToString(claimsJSON)
+
+	digest := sha256.Sum256([]byte(signingInput))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, s.privateKey, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", fmt.Errorf("failed to sign JWT: %w", err)
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// NewGeminiClient returns a client for the Vertex AI endpoint when
+// config.VertexProject is set, authenticated with config.ServiceAccountFile,
+// and a Gemini API client using apiKey otherwise. Both send their requests
+// through config.HTTPClient when it is set.
+func NewGeminiClient(config *Configuration, apiKey string) (*GeminiClient, error) {
+	if config.VertexProject == "" {
+		return &GeminiClient{APIKey: apiKey, HTTPClient: config.HTTPClient}, nil
+	}
+	if config.ServiceAccountFile == "" {
+		return nil, errors.New("vertex AI requires a service account key file")
+	}
+	key, err := LoadServiceAccountKey(config.ServiceAccountFile)
+	if err != nil {
+		return nil, err
+	}
+	tokens, err := NewServiceAccountTokenSource(key, config.TokenURL)
+	if err != nil {
+		return nil, err
+	}
+	tokens.HTTPClient = config.HTTPClient
+	return &GeminiClient{
+		HTTPClient:  config.HTTPClient,
+		Vertex:      &VertexEndpoint{Project: config.VertexProject, Location: config.VertexLocation},
+		TokenSource: tokens,
+	}, nil
+}
@@ -0,0 +1,174 @@
+package agent
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func testServiceAccountKey(t *testing.T) (*ServiceAccountKey, *rsa.PrivateKey) {
+	t.Helper()
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &ServiceAccountKey{
+		Type:         "service_account",
+		PrivateKeyID: "key-1",
+		PrivateKey:   string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+		ClientEmail:  "agent@project.iam.gserviceaccount.com",
+	}, privateKey
+}
+
+// tokenServer issues a new token on every request, valid for expiresIn
+// seconds, after checking the assertion against publicKey.
+func tokenServer(t *testing.T, publicKey *rsa.PublicKey, expiresIn int) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := calls.Add(1)
+		if err := r.ParseForm(); err != nil {
+			t.Error(err)
+		}
+		if got := r.PostForm.Get("grant_type"); got != jwtBearerGrantType {
+			t.Errorf("grant_type = %q", got)
+		}
+		checkJWT(t, r.PostForm.Get("assertion"), publicKey, "http://"+r.Host+r.URL.Path)
+		fmt.Fprintf(w, `{"access_token": "token-%d", "expires_in": %d, "token_type": "Bearer"}`, n, expiresIn)
+	}))
+	t.Cleanup(server.Close)
+	return server, &calls
+}
+
+func checkJWT(t *testing.T, assertion string, publicKey *rsa.PublicKey, audience string) {
+	t.Helper()
+	parts := strings.Split(assertion, ".")
+	if len(parts) != 3 {
+		t.Fatalf("assertion has %d parts, want 3", len(parts))
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(publicKey, crypto.SHA256, digest[:], signature); err != nil {
+		t.Errorf("JWT signature does not verify: %v", err)
+	}
+
+	var header map[string]string
+	decodeSegment(t, parts[0], &header)
+	if header["alg"] != "RS256" || header["typ"] != "JWT" || header["kid"] != "key-1" {
+		t.Errorf("JWT header = %v", header)
+	}
+
+	var claims struct {
+		Iss   string `json:"iss"`
+		Scope string `json:"scope"`
+		Aud   string `json:"aud"`
+		Iat   int64  `json:"iat"`
+		Exp   int64  `json:"exp"`
+	}
+	decodeSegment(t, parts[1], &claims)
+	if claims.Iss != "agent@project.iam.gserviceaccount.com" || claims.Scope != cloudPlatformScope || claims.Aud != audience {
+		t.Errorf("JWT claims = %+v, want audience %s", claims, audience)
+	}
+	if claims.Exp-claims.Iat != int64(jwtLifetime/time.Second) {
+		t.Errorf("JWT lifetime = %ds", claims.Exp-claims.Iat)
+	}
+	if d := time.Since(time.Unix(claims.Iat, 0)); d < -time.Minute || d > time.Minute {
+		t.Errorf("JWT issued %v ago", d)
+	}
+}
+
+func decodeSegment(t *testing.T, segment string, v any) {
+	t.Helper()
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestServiceAccountTokenSourceCachesToken(t *testing.T) {
+	key, privateKey := testServiceAccountKey(t)
+	server, calls := tokenServer(t, &privateKey.PublicKey, 3600)
+
+	tokens, err := NewServiceAccountTokenSource(key, server.URL+"/token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		token, err := tokens.Token(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if token != "token-1" {
+			t.Errorf("call %d: token = %q, want the cached token-1", i, token)
+		}
+	}
+	if n := calls.Load(); n != 1 {
+		t.Errorf("token endpoint called %d times, want 1", n)
+	}
+}
+
+func TestServiceAccountTokenSourceRefreshesNearExpiry(t *testing.T) {
+	key, privateKey := testServiceAccountKey(t)
+	// Tokens that expire within tokenRefreshMargin are never reused.
+	server, calls := tokenServer(t, &privateKey.PublicKey, int(tokenRefreshMargin/time.Second)/2)
+
+	tokens, err := NewServiceAccountTokenSource(key, server.URL+"/token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i <= 2; i++ {
+		token, err := tokens.Token(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := fmt.Sprintf("token-%d", i); token != want {
+			t.Errorf("token = %q, want %q", token, want)
+		}
+	}
+	if n := calls.Load(); n != 2 {
+		t.Errorf("token endpoint called %d times, want 2", n)
+	}
+}
+
+func TestVertexEndpointModelURL(t *testing.T) {
+	tests := []struct {
+		location string
+		baseURL  string
+		want     string
+	}{
+		{"", "", "https://us-central1-aiplatform.googleapis.com/v1/projects/p/locations/us-central1/publishers/google/models/gemini-2.0-flash:generateContent"},
+		{"europe-west4", "", "https://europe-west4-aiplatform.googleapis.com/v1/projects/p/locations/europe-west4/publishers/google/models/gemini-2.0-flash:generateContent"},
+		{"global", "", "https://aiplatform.googleapis.com/v1/projects/p/locations/global/publishers/google/models/gemini-2.0-flash:generateContent"},
+		{"global", "http://localhost:8080/v1/", "http://localhost:8080/v1/projects/p/locations/global/publishers/google/models/gemini-2.0-flash:generateContent"},
+	}
+	for _, tt := range tests {
+		endpoint := &VertexEndpoint{Project: "p", Location: tt.location}
+		if got := endpoint.modelURL(tt.baseURL, "gemini-2.0-flash", "generateContent"); got != tt.want {
+			t.Errorf("modelURL(%q, %q) = %s, want %s", tt.location, tt.baseURL, got, tt.want)
+		}
+	}
+}
@@ -1,25 +1,104 @@
 package agent
 
+import "fmt"
+
 type Workflow struct {
 	Graph *Graph[*OverallState]
+	Nodes *Nodes
 }
 
+// NewWorkflow builds the research graph on the Gemini API with apiKey, or on
+// Vertex AI when config.VertexProject is set.
 func NewWorkflow(config *Configuration, apiKey string) (*Workflow, error) {
+	client, err := NewGeminiClient(config, apiKey)
+	if err != nil {
+		return nil, err
+	}
+	return newWorkflow(NewNodesWithClient(config, client), client)
+}
+
+// NewWorkflowWithClient builds the research graph on top of client instead of
+// the Gemini API.
+func NewWorkflowWithClient(config *Configuration, client ContentGenerator) (*Workflow, error) {
+	return newWorkflow(NewNodesWithClient(config, client), client)
+}
+
+func newWorkflow(nodes *Nodes, client ContentGenerator) (*Workflow, error) {
+	if len(nodes.config.Tools) > 0 {
+		tools, err := BuiltinTools(nodes.config.Tools)
+		if err != nil {
+			return nil, err
+		}
+		if tool, ok := tools.Get("fetch_url"); ok {
+			// Share the results fetcher so both are spaced out per host together.
+			fetcher := nodes.fetcher
+			if fetcher == nil {
+				fetcher = &PageFetcher{Delay: nodes.config.FetchDelay, Timeout: nodes.config.FetchTimeout, MaxBytes: nodes.config.FetchMaxBytes}
+			}
+			tool.(*FetchURLTool).Fetcher = fetcher
+		}
+		nodes.SetTools(tools)
+	}
+
+	search, err := NewSearchProvider(nodes.config, nodes.webSearchLLM)
+	if err != nil {
+		return nil, err
+	}
+	if nodes.limiter != nil {
+		switch nodes.config.SearchProvider {
+		case SearchProviderSearxNG, SearchProviderBrave, SearchProviderTavily:
+			search = &RateLimitedSearchProvider{Next: search, Limiter: nodes.limiter, Key: nodes.config.SearchProvider}
+		}
+	}
+	nodes.SetSearchProvider(search)
+
+	embedder, err := NewQueryEmbedder(nodes.config, client)
+	if err != nil {
+		return nil, err
+	}
+	if gemini, ok := embedder.(*GeminiEmbedder); ok && nodes.limiter != nil {
+		embedder = &RateLimitedEmbedder{Next: gemini, Limiter: nodes.limiter, Key: gemini.model()}
+	}
+	nodes.SetEmbedder(embedder)
+
+	if _, err := MarkerFormatByName(nodes.config.CitationFormat); err != nil {
+		return nil, err
+	}
+
+	switch nodes.config.VerifyClaims {
+	case "", VerifyClaimsAnnotate, VerifyClaimsRewrite:
+	default:
+		return nil, fmt.Errorf("unknown claim verification mode %q", nodes.config.VerifyClaims)
+	}
 
-	nodes := NewNodes(config, apiKey)
+	prompts, err := nodes.config.promptRegistry()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := prompts.Get(nodes.config.PromptSet); err != nil {
+		return nil, err
+	}
+	nodes.SetPrompts(prompts)
 
 	builder := NewGraph[*OverallState]()
 
-	builder.AddNode("GenerateQuery", nodes.GenerateQueryNode)
-	builder.AddNode("WebResearch", nodes.WebResearchNode)
-	builder.AddNode("Reflection", nodes.ReflectionNode)
-	builder.AddNode("FinalizeAnswer", nodes.FinalizeAnswerNode)
+	builder.AddNode("generate_query", nodes.GenerateQueryNode)
+	builder.AddNode("web_research", nodes.WebResearchNode)
+	builder.AddNode("reflection", nodes.ReflectionNode)
+	builder.AddNode("finalize_answer", nodes.FinalizeAnswerNode)
 
-	builder.SetEntryPoint("GenerateQuery")
+	builder.SetEntryPoint("generate_query")
 
-	builder.AddEdge("WebResearch", "Reflection")
+	builder.AddEdge("generate_query", "web_research")
+	builder.AddEdge("web_research", "reflection")
 
-	builder.AddEdge("FinalizeAnswer", GraphEnd)
+	if nodes.config.VerifyClaims != "" {
+		builder.AddNode("verify_claims", nodes.VerifyClaimsNode)
+		builder.AddEdge("finalize_answer", "verify_claims")
+		builder.AddEdge("verify_claims", GraphEnd)
+	} else {
+		builder.AddEdge("finalize_answer", GraphEnd)
+	}
 
 	builder.AddConditionalEdges(
 		"reflection",
@@ -34,5 +113,6 @@ func NewWorkflow(config *Configuration, apiKey string) (*Workflow, error) {
 
 	return &Workflow{
 		Graph: compiledGraph,
+		Nodes: nodes,
 	}, nil
 }
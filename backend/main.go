@@ -13,17 +13,17 @@ import (
 func main() {
 	port := os.Getenv("PORT")
 	apiKey := os.Getenv("GEMINI_API_KEY")
-	if apiKey == "" {
+	if apiKey == "" && os.Getenv("GOOGLE_CLOUD_PROJECT") == "" {
 		fmt.Println("Warning: GEMINI_API_KEY not set. Using mock LLM responses for the agent.")
 		os.Exit(1)
 	}
 
-	config := &agent.Configuration{
-		QueryGeneratorModel:    "gemini-2.0-flash",
-		ReasoningModel:         "gemini-2.0-flash",
-		NumberOfInitialQueries: 3,
-		MaxResearchLoops:       2,
-	}
+	config := agent.NewConfiguration()
+	config.QueryGeneratorModel = "gemini-2.0-flash"
+	config.ReasoningModel = "gemini-2.0-flash"
+	config.NumberOfInitialQueries = 3
+	config.MaxResearchLoops = 2
+	config = config.FromRunnableConfig(nil)
 
 	workflow, err := agent.NewWorkflow(config, apiKey)
 	if err != nil {
@@ -45,6 +45,24 @@ func main() {
 		return
 	}
 	fmt.Printf("\n--- Workflow Execution Completed ---\nFinal State of the Research Agent:\n%+v\n", finalState)
+	fmt.Printf("Token usage: %d tokens, estimated cost $%.4f\n", finalState.Usage.Total.TotalTokenCount, finalState.Usage.EstimatedCost)
+	if config.Cache != "" {
+		fmt.Printf("Response cache: %d hits, %d misses\n", finalState.Usage.CacheHits, finalState.Usage.CacheMisses)
+	}
+	fmt.Printf("Prompt set: %s (version %s)\n", finalState.PromptSet, finalState.PromptVersion)
+	if finalState.Bibliography != nil && len(finalState.Bibliography.Entries) > 0 {
+		fmt.Printf("Sources:\n%s", finalState.Bibliography.APA())
+	}
+	for _, verdict := range finalState.ClaimVerdicts {
+		if !verdict.Supported() {
+			fmt.Printf("Claim %s: %q (%s)\n", verdict.Verdict, verdict.Text, verdict.Reason)
+		}
+	}
+	for _, decision := range finalState.SourceDecisions {
+		if !decision.Kept() {
+			fmt.Printf("Source dropped: %s (%s, rule %q)\n", decision.URL, decision.Action, decision.Rule)
+		}
+	}
 
 	s := api.NewServer()
 	frontendBuildDir := "../frontend/dist"